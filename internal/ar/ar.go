@@ -0,0 +1,250 @@
+// Package ar reads Unix ar archives, the container format of .deb packages.
+// It understands the common variant, GNU long-name tables ("//" and "/N"
+// names) and BSD "#1/len" names, and exposes members the way archive/tar
+// does: call Next for each header and read the body from the Reader.
+package ar
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	Magic      = "!<arch>\n"
+	headerSize = 60
+	headerTerm = "`\n"
+
+	// maxNameTable bounds the GNU "//" member we keep in memory.
+	maxNameTable = 1 << 20
+)
+
+var (
+	ErrBadMagic  = errors.New("ar: bad magic")
+	ErrBadHeader = errors.New("ar: malformed member header")
+	ErrTruncated = errors.New("ar: archive truncated")
+)
+
+type Header struct {
+	Name    string
+	ModTime time.Time
+	UID     int
+	GID     int
+	Mode    os.FileMode
+	Size    int64
+}
+
+type Reader struct {
+	r      io.Reader
+	offset int64 // bytes consumed from r, for error messages
+	remain int64 // unread bytes of the current member body
+	pad    bool  // current member body is followed by a '\n' pad byte
+	names  []byte
+}
+
+// NewReader checks the global header and positions r at the first member.
+func NewReader(r io.Reader) (*Reader, error) {
+	buf := make([]byte, len(Magic))
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBadMagic, err)
+	}
+	if string(buf) != Magic {
+		return nil, fmt.Errorf("%w: %q", ErrBadMagic, buf)
+	}
+	return &Reader{r: r, offset: int64(len(Magic))}, nil
+}
+
+// Next skips the rest of the current member and returns the next header, or
+// io.EOF after the last one. Symbol tables and the GNU name table are
+// consumed internally and never returned.
+func (ar *Reader) Next() (*Header, error) {
+	for {
+		if err := ar.skip(); err != nil {
+			return nil, err
+		}
+
+		buf := make([]byte, headerSize)
+		n, err := io.ReadFull(ar.r, buf)
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: header at offset %d: got %d of %d bytes", ErrTruncated, ar.offset, n, headerSize)
+		}
+		hdr, err := ar.parseHeader(buf)
+		if err != nil {
+			return nil, err
+		}
+		ar.offset += headerSize
+		ar.remain = hdr.Size
+		ar.pad = hdr.Size%2 != 0
+
+		switch {
+		case hdr.Name == "/" || hdr.Name == "/SYM64/":
+			continue
+		case hdr.Name == "//":
+			if hdr.Size > maxNameTable {
+				return nil, fmt.Errorf("%w: name table of %d bytes", ErrBadHeader, hdr.Size)
+			}
+			if ar.names, err = io.ReadAll(ar); err != nil {
+				return nil, err
+			}
+			continue
+		case strings.HasPrefix(hdr.Name, "#1/"):
+			if err := ar.readBSDName(hdr); err != nil {
+				return nil, err
+			}
+		case strings.HasPrefix(hdr.Name, "/"):
+			if hdr.Name, err = ar.gnuLongName(hdr.Name); err != nil {
+				return nil, err
+			}
+		}
+		return hdr, nil
+	}
+}
+
+// Read reads from the body of the current member.
+func (ar *Reader) Read(p []byte) (int, error) {
+	if ar.remain <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > ar.remain {
+		p = p[:ar.remain]
+	}
+	n, err := ar.r.Read(p)
+	ar.remain -= int64(n)
+	ar.offset += int64(n)
+	if err == io.EOF && ar.remain > 0 {
+		return n, fmt.Errorf("%w: member body ends %d bytes early", ErrTruncated, ar.remain)
+	}
+	if err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
+
+func (ar *Reader) skip() error {
+	if ar.remain > 0 {
+		n, err := io.CopyN(io.Discard, ar.r, ar.remain)
+		ar.offset += n
+		if err != nil {
+			return fmt.Errorf("%w: member body ends %d bytes early", ErrTruncated, ar.remain-n)
+		}
+		ar.remain = 0
+	}
+	if ar.pad {
+		ar.pad = false
+		var b [1]byte
+		if _, err := io.ReadFull(ar.r, b[:]); err != nil {
+			// A missing final pad byte is common and harmless.
+			if err == io.EOF {
+				return io.EOF
+			}
+			return fmt.Errorf("%w: pad byte: %v", ErrTruncated, err)
+		}
+		ar.offset++
+	}
+	return nil
+}
+
+func (ar *Reader) parseHeader(buf []byte) (*Header, error) {
+	if string(buf[58:60]) != headerTerm {
+		return nil, fmt.Errorf("%w: bad terminator %q at offset %d", ErrBadHeader, buf[58:60], ar.offset)
+	}
+	field := func(from, to int) string { return strings.TrimRight(string(buf[from:to]), " ") }
+	num := func(name string, from, to, base int) (int64, error) {
+		s := field(from, to)
+		if s == "" {
+			return 0, nil
+		}
+		v, err := strconv.ParseInt(s, base, 64)
+		if err != nil || v < 0 {
+			return 0, fmt.Errorf("%w: %s %q at offset %d", ErrBadHeader, name, s, ar.offset)
+		}
+		return v, nil
+	}
+
+	mtime, err := num("mtime", 16, 28, 10)
+	if err != nil {
+		return nil, err
+	}
+	uid, err := num("uid", 28, 34, 10)
+	if err != nil {
+		return nil, err
+	}
+	gid, err := num("gid", 34, 40, 10)
+	if err != nil {
+		return nil, err
+	}
+	mode, err := num("mode", 40, 48, 8)
+	if err != nil {
+		return nil, err
+	}
+	size, err := num("size", 48, 58, 10)
+	if err != nil {
+		return nil, err
+	}
+
+	name := field(0, 16)
+	// GNU terminates short names with '/', but "/" and "//" are names
+	// in their own right.
+	if name != "/" && name != "//" && !strings.HasPrefix(name, "/") {
+		name = strings.TrimSuffix(name, "/")
+	}
+	return &Header{
+		Name:    name,
+		ModTime: time.Unix(mtime, 0),
+		UID:     int(uid),
+		GID:     int(gid),
+		Mode:    fileMode(mode),
+		Size:    size,
+	}, nil
+}
+
+// fileMode converts a Unix st_mode to an os.FileMode, whose setuid,
+// setgid and sticky bits are not where Unix keeps them.
+func fileMode(mode int64) os.FileMode {
+	m := os.FileMode(mode & 0o777)
+	if mode&0o4000 != 0 {
+		m |= os.ModeSetuid
+	}
+	if mode&0o2000 != 0 {
+		m |= os.ModeSetgid
+	}
+	if mode&0o1000 != 0 {
+		m |= os.ModeSticky
+	}
+	return m
+}
+
+func (ar *Reader) readBSDName(hdr *Header) error {
+	n, err := strconv.ParseInt(strings.TrimPrefix(hdr.Name, "#1/"), 10, 64)
+	if err != nil || n <= 0 || n > hdr.Size {
+		return fmt.Errorf("%w: BSD name %q at offset %d", ErrBadHeader, hdr.Name, ar.offset)
+	}
+	name := make([]byte, n)
+	if _, err := io.ReadFull(ar, name); err != nil {
+		return err
+	}
+	hdr.Name = string(bytes.TrimRight(name, "\x00"))
+	hdr.Size -= n
+	return nil
+}
+
+func (ar *Reader) gnuLongName(ref string) (string, error) {
+	off, err := strconv.Atoi(strings.TrimPrefix(ref, "/"))
+	if err != nil || off < 0 || off >= len(ar.names) {
+		return "", fmt.Errorf("%w: long name reference %q without matching name table", ErrBadHeader, ref)
+	}
+	rest := ar.names[off:]
+	end := bytes.IndexByte(rest, '\n')
+	if end < 0 {
+		end = len(rest)
+	}
+	return strings.TrimSuffix(string(rest[:end]), "/"), nil
+}
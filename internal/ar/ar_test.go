@@ -0,0 +1,202 @@
+package ar
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+// hdr formats a 60-byte member header with the given name and size.
+func hdr(name string, size int) string {
+	return fmt.Sprintf("%-16s%-12d%-6d%-6d%-8o%-10d`\n", name, 1700000000, 0, 0, 0o644, size)
+}
+
+// member is a header plus body plus the pad byte an odd size needs.
+func member(name, body string) string {
+	s := hdr(name, len(body)) + body
+	if len(body)%2 != 0 {
+		s += "\n"
+	}
+	return s
+}
+
+type entry struct{ name, body string }
+
+func readArchive(data string) ([]entry, error) {
+	r, err := NewReader(strings.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	var got []entry
+	for {
+		h, err := r.Next()
+		if err == io.EOF {
+			return got, nil
+		}
+		if err != nil {
+			return got, err
+		}
+		body, err := io.ReadAll(r)
+		if err != nil {
+			return got, err
+		}
+		if int64(len(body)) != h.Size {
+			return got, fmt.Errorf("%s: read %d bytes, header says %d", h.Name, len(body), h.Size)
+		}
+		got = append(got, entry{h.Name, string(body)})
+	}
+}
+
+func TestReader(t *testing.T) {
+	gnuNames := "a-very-long-member-name.tar.xz/\ncontrol.tar.gz.sig/\n"
+	tests := []struct {
+		name    string
+		data    string
+		want    []entry
+		wantErr error
+	}{
+		{
+			name: "deb layout",
+			data: Magic + member("debian-binary/", "2.0\n") + member("control.tar.xz/", "ctl") + member("data.tar.xz/", "data"),
+			want: []entry{{"debian-binary", "2.0\n"}, {"control.tar.xz", "ctl"}, {"data.tar.xz", "data"}},
+		},
+		{
+			name: "odd sizes are padded",
+			data: Magic + member("a", "x") + member("b", "yyy") + member("c", "zz"),
+			want: []entry{{"a", "x"}, {"b", "yyy"}, {"c", "zz"}},
+		},
+		{
+			name: "missing final pad byte",
+			data: Magic + member("a", "ab") + hdr("b", 3) + "xyz",
+			want: []entry{{"a", "ab"}, {"b", "xyz"}},
+		},
+		{
+			name: "empty archive",
+			data: Magic,
+		},
+		{
+			name: "symbol table skipped",
+			data: Magic + member("/", "\x00\x00\x00\x00") + member("/SYM64/", "12345678") + member("f", "body"),
+			want: []entry{{"f", "body"}},
+		},
+		{
+			name: "GNU long names",
+			data: Magic + member("//", gnuNames) + member("/0", "one") + member("/32", "two"),
+			want: []entry{{"a-very-long-member-name.tar.xz", "one"}, {"control.tar.gz.sig", "two"}},
+		},
+		{
+			name: "BSD long name",
+			data: Magic + member("#1/24", "a-very-long-name.tar.xz\x00body"),
+			want: []entry{{"a-very-long-name.tar.xz", "body"}},
+		},
+		{
+			name:    "bad magic",
+			data:    "!<arch>X" + member("a", "x"),
+			wantErr: ErrBadMagic,
+		},
+		{
+			name:    "short magic",
+			data:    "!<ar",
+			wantErr: ErrBadMagic,
+		},
+		{
+			name:    "bad terminator",
+			data:    Magic + strings.Replace(hdr("a", 1), "`\n", "XX", 1) + "x\n",
+			wantErr: ErrBadHeader,
+		},
+		{
+			name:    "non-numeric size",
+			data:    Magic + "a               1700000000  0     0     644     12x4567890`\n",
+			wantErr: ErrBadHeader,
+		},
+		{
+			name:    "truncated header",
+			data:    Magic + hdr("a", 1)[:30],
+			wantErr: ErrTruncated,
+		},
+		{
+			name:    "truncated body",
+			data:    Magic + hdr("a", 10) + "short",
+			wantErr: ErrTruncated,
+		},
+		{
+			name:    "truncated body of skipped member",
+			data:    Magic + member("/", "") + hdr("/", 10) + "shor",
+			wantErr: ErrTruncated,
+		},
+		{
+			name:    "GNU reference without name table",
+			data:    Magic + member("/0", "x"),
+			wantErr: ErrBadHeader,
+		},
+		{
+			name:    "GNU reference past name table",
+			data:    Magic + member("//", gnuNames) + member("/999", "x"),
+			wantErr: ErrBadHeader,
+		},
+		{
+			name:    "BSD name longer than member",
+			data:    Magic + member("#1/40", "short"),
+			wantErr: ErrBadHeader,
+		},
+		{
+			name:    "BSD name not a number",
+			data:    Magic + member("#1/xy", "body"),
+			wantErr: ErrBadHeader,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readArchive(tt.data)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("members = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHeaderFields(t *testing.T) {
+	data := Magic + "f/              1700000000  1000  100   100755  3         `\nabc\n"
+	r, err := NewReader(bytes.NewReader([]byte(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := r.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Name != "f" || h.ModTime.Unix() != 1700000000 || h.UID != 1000 || h.GID != 100 || h.Mode != 0o755 || h.Size != 3 {
+		t.Errorf("header = %+v", h)
+	}
+}
+
+func TestFileMode(t *testing.T) {
+	tests := []struct {
+		mode int64
+		want os.FileMode
+	}{
+		{0o100644, 0o644},
+		{0o104755, os.ModeSetuid | 0o755},
+		{0o102755, os.ModeSetgid | 0o755},
+		{0o41777, os.ModeSticky | 0o777},
+		{0o107777, os.ModeSetuid | os.ModeSetgid | os.ModeSticky | 0o777},
+	}
+	for _, tt := range tests {
+		if got := fileMode(tt.mode); got != tt.want {
+			t.Errorf("fileMode(%#o) = %v, want %v", tt.mode, got, tt.want)
+		}
+	}
+}
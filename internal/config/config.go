@@ -2,8 +2,14 @@ package config
 
 import (
 	"flag"
-	ui "github.com/you/mullvad-installer/internal/ui"
+	"fmt"
 	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	ui "github.com/you/mullvad-installer/internal/ui"
 )
 
 type ActionType string
@@ -12,53 +18,171 @@ const (
 	ActionInstall ActionType = "install"
 	ActionRemove  ActionType = "remove"
 	ActionUpgrade ActionType = "upgrade"
+	ActionInspect ActionType = "inspect"
+	ActionStatus  ActionType = "status"
+
+	ActionRenderService ActionType = "render-service"
 )
 
 type Config struct {
 	AssumeYes bool
 	DryRun    bool
 	NoColor   bool
+	Verbose   bool
 	ForceAll  bool
 	Action    ActionType
 	Channel   string // stable|beta
+	JSON      bool
+	Args      []string // positional arguments after the subcommand
+
+	MaxExtractBytes int64  // 0 means debpkg.DefaultMaxBytes
+	MaxExtractFiles int    // 0 means debpkg.DefaultMaxFiles
+	Extractor       string // backend name, or "auto" to benchmark
+
+	PathMap   map[string]string // top-level package dir → host dir
+	SkipPaths []string          // top-level package dirs never installed
+
+	Init string // init system name, or "auto" to detect
+
+	// Service template parameters.
+	DaemonPath      string
+	DaemonVerbosity int
+	DaemonEnv       map[string]string
+	LogDir          string
+	NetworkWait     NetworkWait
+	RestartDelay    time.Duration
+
+	// systemd drop-in for mullvad-daemon.service.
+	SystemdHardening bool
+	SystemdSettings  []string // extra [Service] directives, as Key=Value
+
+	HealthTimeout time.Duration // how long a started daemon has to come up; 0 skips the check
+}
+
+// NetworkWait is how long a service that cannot depend on networking
+// polls for a default route before starting the daemon: Tries checks,
+// Interval apart. Tries 0 starts the daemon without waiting.
+type NetworkWait struct {
+	Tries    int
+	Interval time.Duration
 }
 
 var (
 	flagYes      bool
 	flagDryRun   bool
 	flagNoColor  bool
+	flagVerbose  bool
 	flagForceAll bool
+	flagRemove   bool
+	flagUpgrade  bool
 	flagChannel  string
+	flagJSON     bool
+	flagMaxMB    int64
+	flagMaxFiles int
+	flagExtract  string
+	flagPathMap  = pathMapFlag{}
+	flagSkip     listFlag
+	flagInit     string
+	flagDaemon   string
+	flagDaemonV  int
+	flagEnv      = envFlag{}
+	flagLogDir   string
+	flagNetWait  = NetworkWait{Tries: 30, Interval: 2 * time.Second}
+	flagRestart  time.Duration
+	flagHarden   bool
+	flagUnitSet  directiveFlag
+	flagHealth   time.Duration
 )
 
 func init() {
+	// Parse errors are returned from ParseFlags rather than exiting, so
+	// the caller decides how to report them.
+	flag.CommandLine.Init(os.Args[0], flag.ContinueOnError)
 	flag.BoolVar(&flagYes, "yes", false, "assume yes to all prompts")
 	flag.BoolVar(&flagDryRun, "dry-run", false, "show actions but do not execute")
 	flag.BoolVar(&flagNoColor, "no-color", false, "disable colored output")
+	flag.BoolVar(&flagVerbose, "verbose", false, "explain decisions such as init system detection")
 	flag.BoolVar(&flagForceAll, "force-remove-all", false, "skip all remove prompts (implies --yes)")
+	flag.BoolVar(&flagRemove, "remove", false, "uninstall Mullvad VPN, configuration under /etc included")
+	flag.BoolVar(&flagUpgrade, "upgrade", false, "upgrade an existing installation")
 	flag.StringVar(&flagChannel, "channel", "", "release channel: stable|beta (if omitted, will prompt)")
+	flag.BoolVar(&flagJSON, "json", false, "machine-readable output for inspect")
+	flag.Int64Var(&flagMaxMB, "max-extract-mb", 0, "abort extraction past this many MiB (0 = built-in default)")
+	flag.IntVar(&flagMaxFiles, "max-extract-files", 0, "abort extraction past this many entries (0 = built-in default)")
+	flag.StringVar(&flagExtract, "extractor", "auto", "extractor backend: auto|builtin|binutils|bsdtar|busybox")
+	flag.Var(flagPathMap, "map-path", "install package dir TOP to DIR, as TOP=DIR (repeatable)")
+	flag.Var(&flagSkip, "skip-path", "never install package dir TOP (repeatable)")
+	flag.StringVar(&flagDaemon, "daemon-path", "/usr/bin/mullvad-daemon", "mullvad-daemon binary the service runs")
+	flag.IntVar(&flagDaemonV, "daemon-verbosity", 1, "number of -v flags passed to mullvad-daemon")
+	flag.Var(flagEnv, "daemon-env", "set KEY=VALUE in the daemon's environment (repeatable)")
+	flag.StringVar(&flagLogDir, "log-dir", "/var/log/mullvad-daemon", "directory for daemon logs")
+	flag.Var(&flagNetWait, "network-wait", "poll for a default route before starting, as TRIESxINTERVAL (e.g. 30x2s), or none")
+	flag.DurationVar(&flagRestart, "restart-delay", 5*time.Second, "delay before restarting a crashed daemon")
+	flag.BoolVar(&flagHarden, "systemd-hardening", false, "sandbox mullvad-daemon.service through a drop-in")
+	flag.Var(&flagUnitSet, "systemd-set", "add Key=Value to the [Service] section of the drop-in (repeatable)")
+	flag.DurationVar(&flagHealth, "health-timeout", 30*time.Second, "wait this long for the new daemon to come up before rolling back (0 = don't check)")
+	flag.StringVar(&flagInit, "init", "auto", "init system: auto|systemd|runit|sysvinit|openrc|s6|dinit|shepherd|finit|66")
 }
 
-func ParseFlags() *Config {
-	flag.Parse()
+// ParseFlags parses the command line. -h and --help return flag.ErrHelp
+// after printing the usage.
+func ParseFlags() (*Config, error) {
+	if err := flag.CommandLine.Parse(os.Args[1:]); err != nil {
+		return nil, err
+	}
 
-	act := ActionInstall
-	for _, a := range os.Args[1:] {
-		switch a {
-		case "--remove":
-			act = ActionRemove
-		case "--upgrade":
-			act = ActionUpgrade
+	var args []string
+	sub := ActionType(flag.Arg(0))
+	subcommand := sub == ActionInspect || sub == ActionStatus || sub == ActionRenderService
+	if subcommand {
+		// Flags may follow the subcommand too: inspect --json pkg.deb
+		if err := flag.CommandLine.Parse(flag.Args()[1:]); err != nil {
+			return nil, fmt.Errorf("%s: %w", sub, err)
 		}
+		args = flag.Args()
+	}
+
+	act := ActionInstall
+	switch {
+	case flagRemove:
+		act = ActionRemove
+	case flagUpgrade:
+		act = ActionUpgrade
+	}
+	if subcommand {
+		act = sub
 	}
 
 	cfg := &Config{
 		AssumeYes: flagYes || flagForceAll,
 		DryRun:    flagDryRun,
 		NoColor:   flagNoColor,
+		Verbose:   flagVerbose,
 		ForceAll:  flagForceAll,
 		Action:    act,
 		Channel:   flagChannel,
+		JSON:      flagJSON,
+		Args:      args,
+
+		MaxExtractBytes: flagMaxMB << 20,
+		MaxExtractFiles: flagMaxFiles,
+		Extractor:       flagExtract,
+		PathMap:         flagPathMap,
+		SkipPaths:       flagSkip,
+
+		Init: flagInit,
+
+		DaemonPath:      flagDaemon,
+		DaemonVerbosity: flagDaemonV,
+		DaemonEnv:       flagEnv,
+		LogDir:          flagLogDir,
+		NetworkWait:     flagNetWait,
+		RestartDelay:    flagRestart,
+
+		SystemdHardening: flagHarden,
+		SystemdSettings:  flagUnitSet,
+
+		HealthTimeout: flagHealth,
 	}
 
 	if cfg.Action != ActionRemove && cfg.Channel == "" {
@@ -67,5 +191,98 @@ func ParseFlags() *Config {
 	if cfg.Channel == "" {
 		cfg.Channel = "stable"
 	}
-	return cfg
+	return cfg, nil
+}
+
+type pathMapFlag map[string]string
+
+func (m pathMapFlag) String() string {
+	parts := make([]string, 0, len(m))
+	for k, v := range m {
+		parts = append(parts, k+"="+v)
+	}
+	return strings.Join(parts, ",")
+}
+
+func (m pathMapFlag) Set(v string) error {
+	top, dir, ok := strings.Cut(v, "=")
+	top = strings.Trim(top, "/")
+	if !ok || top == "" || strings.Contains(top, "/") || !strings.HasPrefix(dir, "/") {
+		return fmt.Errorf("want TOP=/absolute/dir, got %q", v)
+	}
+	m[top] = dir
+	return nil
+}
+
+type listFlag []string
+
+func (l *listFlag) String() string { return strings.Join(*l, ",") }
+
+func (l *listFlag) Set(v string) error {
+	*l = append(*l, strings.Trim(v, "/"))
+	return nil
+}
+
+type envFlag map[string]string
+
+func (m envFlag) String() string {
+	parts := make([]string, 0, len(m))
+	for k, v := range m {
+		parts = append(parts, k+"="+v)
+	}
+	return strings.Join(parts, ",")
+}
+
+// envKey is what a shell accepts as a variable name. Init scripts export
+// the key unquoted, so anything else could be shell code.
+var envKey = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+func (m envFlag) Set(v string) error {
+	k, val, ok := strings.Cut(v, "=")
+	if !ok || !envKey.MatchString(k) {
+		return fmt.Errorf("want KEY=VALUE with KEY a variable name, got %q", v)
+	}
+	m[k] = val
+	return nil
+}
+
+// directiveFlag collects unit file directives such as ProtectHome=yes.
+type directiveFlag []string
+
+func (d *directiveFlag) String() string { return strings.Join(*d, ",") }
+
+func (d *directiveFlag) Set(v string) error {
+	k, _, ok := strings.Cut(v, "=")
+	if !ok || k == "" || strings.IndexFunc(k, func(r rune) bool {
+		return !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9')
+	}) >= 0 || strings.Contains(v, "\n") {
+		return fmt.Errorf("want Key=Value, got %q", v)
+	}
+	*d = append(*d, v)
+	return nil
+}
+
+func (w *NetworkWait) String() string {
+	if w.Tries == 0 {
+		return "none"
+	}
+	return fmt.Sprintf("%dx%s", w.Tries, w.Interval)
+}
+
+func (w *NetworkWait) Set(v string) error {
+	if v == "none" || v == "0" {
+		*w = NetworkWait{}
+		return nil
+	}
+	tries, interval, ok := strings.Cut(v, "x")
+	n, err := strconv.Atoi(tries)
+	if !ok || err != nil || n < 0 {
+		return fmt.Errorf("want TRIESxINTERVAL or none, got %q", v)
+	}
+	d, err := time.ParseDuration(interval)
+	if err != nil || d <= 0 {
+		return fmt.Errorf("want TRIESxINTERVAL or none, got %q", v)
+	}
+	*w = NetworkWait{Tries: n, Interval: d}
+	return nil
 }
@@ -0,0 +1,25 @@
+package config
+
+import "testing"
+
+func TestEnvFlag(t *testing.T) {
+	tests := []struct {
+		in string
+		ok bool
+	}{
+		{"MULLVAD_RPC_SOCKET_PATH=/run/m.sock", true},
+		{"_X1=a b;c", true}, // values are quoted by the templates
+		{"A;rm -rf /x=1", false},
+		{"A$(id)=1", false},
+		{"1A=1", false},
+		{"A B=1", false},
+		{"=1", false},
+		{"NOVALUE", false},
+	}
+	for _, tt := range tests {
+		m := envFlag{}
+		if err := m.Set(tt.in); (err == nil) != tt.ok {
+			t.Errorf("Set(%q) = %v, want ok=%v", tt.in, err, tt.ok)
+		}
+	}
+}
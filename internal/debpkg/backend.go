@@ -0,0 +1,266 @@
+package debpkg
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	BackendAuto = "auto"
+
+	// benchSample is how much decompressed data.tar each backend gets to
+	// produce when PickBackend times them.
+	benchSample = 16 << 20
+)
+
+// pickCachePath remembers which backend PickBackend chose, among which and
+// for which data.tar compression, so the benchmark runs again only when
+// the installed tools or the package format change.
+var pickCachePath = "/var/cache/mullvad-installer/extractor"
+
+var (
+	ErrUnknownBackend     = errors.New("unknown extractor backend")
+	ErrBackendUnavailable = errors.New("extractor backend not available")
+)
+
+// Backend produces the decompressed data.tar stream of a .deb.
+type Backend interface {
+	Name() string
+	Description() string
+	// Available reports whether the tools the backend needs are installed.
+	Available() bool
+	Open(debPath string) (io.ReadCloser, error)
+}
+
+var backends = []Backend{
+	builtinBackend{},
+	binutilsBackend{},
+	bsdtarBackend{},
+	busyboxBackend{},
+}
+
+func Backends() []Backend { return backends }
+
+func Builtin() Backend { return backends[0] }
+
+func LookupBackend(name string) (Backend, error) {
+	for _, be := range backends {
+		if be.Name() == name {
+			if !be.Available() {
+				return nil, fmt.Errorf("%w: %s", ErrBackendUnavailable, name)
+			}
+			return be, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnknownBackend, name)
+}
+
+type BenchResult struct {
+	Backend Backend
+	Elapsed time.Duration
+	Bytes   int64
+	Err     error
+}
+
+// PickBackend times every available backend on the first benchSample bytes
+// of debPath's data.tar and returns the fastest one that worked, together
+// with all measurements. The built-in backend is always a candidate. The
+// choice is cached for as long as the same backends are available and the
+// data.tar is compressed the same way; results is empty when it came from
+// the cache.
+func PickBackend(debPath string) (Backend, []BenchResult) {
+	var available []Backend
+	var names []string
+	for _, be := range backends {
+		if be.Available() {
+			available = append(available, be)
+			names = append(names, be.Name())
+		}
+	}
+	member, _ := dataMember(debPath)
+	key := path.Ext(member) + " " + strings.Join(names, ",")
+	if data, err := os.ReadFile(pickCachePath); err == nil {
+		if chosen, among, ok := strings.Cut(strings.TrimSpace(string(data)), " "); ok && among == key {
+			for _, be := range available {
+				if be.Name() == chosen {
+					return be, nil
+				}
+			}
+		}
+	}
+
+	var (
+		results []BenchResult
+		best    = Builtin()
+		bestBPS float64
+	)
+	for _, be := range available {
+		res := bench(be, debPath)
+		results = append(results, res)
+		if res.Err != nil || res.Elapsed <= 0 {
+			continue
+		}
+		if bps := float64(res.Bytes) / res.Elapsed.Seconds(); bps > bestBPS {
+			best, bestBPS = be, bps
+		}
+	}
+	// Without a cache the benchmark just runs again next time.
+	if err := os.MkdirAll(path.Dir(pickCachePath), 0o755); err == nil {
+		_ = os.WriteFile(pickCachePath, []byte(best.Name()+" "+key+"\n"), 0o644)
+	}
+	return best, results
+}
+
+func bench(be Backend, debPath string) BenchResult {
+	res := BenchResult{Backend: be}
+	start := time.Now()
+	r, err := be.Open(debPath)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	res.Bytes, err = io.CopyN(io.Discard, r, benchSample)
+	res.Elapsed = time.Since(start)
+	if err != nil && err != io.EOF {
+		res.Err = err
+	}
+	_ = r.Close()
+	return res
+}
+
+// dataMember reads the ar index of debPath and returns the name of its
+// data.tar member, which tells the external backends what to ask for and
+// how it is compressed.
+func dataMember(debPath string) (string, error) {
+	f, err := os.Open(debPath)
+	if err != nil {
+		return "", fmt.Errorf("open .deb: %w", err)
+	}
+	defer f.Close()
+	name, _, err := findDataTar(bufio.NewReader(f))
+	return name, err
+}
+
+func haveCmds(names ...string) bool {
+	for _, n := range names {
+		if _, err := exec.LookPath(n); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+type builtinBackend struct{}
+
+func (builtinBackend) Name() string { return "builtin" }
+func (builtinBackend) Description() string {
+	return "Built-in parsers (Go ar + Go xz; portable, slower)"
+}
+func (builtinBackend) Available() bool { return true }
+
+func (builtinBackend) Open(debPath string) (io.ReadCloser, error) {
+	f, err := os.Open(debPath)
+	if err != nil {
+		return nil, fmt.Errorf("open .deb: %w", err)
+	}
+	name, body, err := findDataTar(bufio.NewReader(f))
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	r, err := decompressMember(name, body)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return readCloser{r, f}, nil
+}
+
+type binutilsBackend struct{}
+
+func (binutilsBackend) Name() string { return "binutils" }
+func (binutilsBackend) Description() string {
+	return "binutils ar + xz -T0 (multithreaded)"
+}
+func (binutilsBackend) Available() bool { return haveCmds("ar", "xz") }
+
+func (binutilsBackend) Open(debPath string) (io.ReadCloser, error) {
+	member, err := dataMember(debPath)
+	if err != nil {
+		return nil, err
+	}
+	if path.Ext(member) != ".xz" {
+		return nil, fmt.Errorf("%s: only .xz is supported by this backend", member)
+	}
+	arOut, err := newSystemArStream(debPath, member)
+	if err != nil {
+		return nil, err
+	}
+	return newSystemXZReader(arOut)
+}
+
+// bsdtarBackend uses libarchive twice: once to pull the member out of the
+// .deb (libarchive reads ar natively) and once to decompress it and emit a
+// plain pax stream, whatever the compression.
+type bsdtarBackend struct{}
+
+func (bsdtarBackend) Name() string        { return "bsdtar" }
+func (bsdtarBackend) Description() string { return "libarchive bsdtar (reads .deb natively)" }
+func (bsdtarBackend) Available() bool     { return haveCmds("bsdtar") }
+
+func (bsdtarBackend) Open(debPath string) (io.ReadCloser, error) {
+	member, err := dataMember(debPath)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := startCmd(exec.Command("bsdtar", "-xOf", debPath, member), nil, ErrBackendUnavailable)
+	if err != nil {
+		return nil, err
+	}
+	return startCmd(exec.Command("bsdtar", "-cf", "-", "--format", "pax", "@-"), raw, ErrBackendUnavailable)
+}
+
+type busyboxBackend struct{}
+
+func (busyboxBackend) Name() string        { return "busybox" }
+func (busyboxBackend) Description() string { return "busybox ar + unxz" }
+
+func (busyboxBackend) Available() bool {
+	if !haveCmds("busybox") {
+		return false
+	}
+	out, err := exec.Command("busybox", "--list").Output()
+	if err != nil {
+		return false
+	}
+	applets := strings.Fields(string(out))
+	return slices.Contains(applets, "ar") && slices.Contains(applets, "unxz")
+}
+
+func (busyboxBackend) Open(debPath string) (io.ReadCloser, error) {
+	member, err := dataMember(debPath)
+	if err != nil {
+		return nil, err
+	}
+	if path.Ext(member) != ".xz" {
+		return nil, fmt.Errorf("%s: only .xz is supported by this backend", member)
+	}
+	raw, err := startCmd(exec.Command("busybox", "ar", "-p", debPath, member), nil, ErrArNotFound)
+	if err != nil {
+		return nil, err
+	}
+	return startCmd(exec.Command("busybox", "unxz", "-c"), raw, ErrXZNotFound)
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,138 @@
+package debpkg
+
+import (
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeBackend produces size bytes after delay, or fails to open with err.
+type fakeBackend struct {
+	name  string
+	avail bool
+	err   error
+	delay time.Duration
+	opens *int
+}
+
+func (f fakeBackend) Name() string        { return f.name }
+func (f fakeBackend) Description() string { return f.name }
+func (f fakeBackend) Available() bool     { return f.avail }
+
+func (f fakeBackend) Open(string) (io.ReadCloser, error) {
+	*f.opens++
+	if f.err != nil {
+		return nil, f.err
+	}
+	time.Sleep(f.delay)
+	return io.NopCloser(strings.NewReader(strings.Repeat("x", 1<<16))), nil
+}
+
+// setBackends swaps in fakes, with the first as the built-in one, and an
+// empty choice cache.
+func setBackends(t *testing.T, fakes ...fakeBackend) {
+	t.Helper()
+	oldBackends, oldCache := backends, pickCachePath
+	t.Cleanup(func() { backends, pickCachePath = oldBackends, oldCache })
+	backends = nil
+	for _, f := range fakes {
+		backends = append(backends, f)
+	}
+	pickCachePath = filepath.Join(t.TempDir(), "extractor")
+}
+
+func TestPickBackend(t *testing.T) {
+	slow, fast := 30*time.Millisecond, time.Duration(0)
+	broken := errors.New("broken")
+	tests := []struct {
+		name    string
+		fakes   []fakeBackend
+		want    string
+		benched int // backends that were timed
+	}{
+		{"only builtin available", []fakeBackend{
+			{name: "builtin", avail: true, delay: slow},
+			{name: "binutils", delay: fast},
+		}, "builtin", 1},
+		{"faster external", []fakeBackend{
+			{name: "builtin", avail: true, delay: slow},
+			{name: "binutils", avail: true, delay: fast},
+		}, "binutils", 2},
+		{"external fails", []fakeBackend{
+			{name: "builtin", avail: true, delay: slow},
+			{name: "bsdtar", avail: true, err: broken},
+		}, "builtin", 2},
+		{"everything fails", []fakeBackend{
+			{name: "builtin", avail: true, err: broken},
+			{name: "bsdtar", avail: true, err: broken},
+		}, "builtin", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opens := 0
+			for i := range tt.fakes {
+				tt.fakes[i].opens = &opens
+			}
+			setBackends(t, tt.fakes...)
+
+			be, results := PickBackend("missing.deb")
+			if be.Name() != tt.want || len(results) != tt.benched {
+				t.Fatalf("PickBackend = %s with %d results, want %s with %d", be.Name(), len(results), tt.want, tt.benched)
+			}
+
+			// The second install reuses the choice without timing anything.
+			opens = 0
+			be, results = PickBackend("missing.deb")
+			if be.Name() != tt.want || results != nil || opens != 0 {
+				t.Errorf("cached PickBackend = %s, %d results, %d opens; want %s from the cache", be.Name(), len(results), opens, tt.want)
+			}
+		})
+	}
+}
+
+func TestPickBackendRebenchesWhenToolsChange(t *testing.T) {
+	opens := 0
+	setBackends(t,
+		fakeBackend{name: "builtin", avail: true, delay: 30 * time.Millisecond, opens: &opens},
+		fakeBackend{name: "binutils", opens: &opens})
+	if be, _ := PickBackend("missing.deb"); be.Name() != "builtin" {
+		t.Fatalf("PickBackend = %s, want builtin", be.Name())
+	}
+
+	cache := pickCachePath
+	setBackends(t,
+		fakeBackend{name: "builtin", avail: true, delay: 30 * time.Millisecond, opens: &opens},
+		fakeBackend{name: "binutils", avail: true, opens: &opens})
+	pickCachePath = cache
+	be, results := PickBackend("missing.deb")
+	if be.Name() != "binutils" || len(results) != 2 {
+		t.Errorf("PickBackend after binutils appeared = %s with %d results, want a fresh benchmark picking binutils", be.Name(), len(results))
+	}
+}
+
+func TestLookupBackend(t *testing.T) {
+	opens := 0
+	setBackends(t,
+		fakeBackend{name: "builtin", avail: true, opens: &opens},
+		fakeBackend{name: "bsdtar", opens: &opens})
+	tests := []struct {
+		name    string
+		wantErr error
+	}{
+		{"builtin", nil},
+		{"bsdtar", ErrBackendUnavailable},
+		{"dpkg", ErrUnknownBackend},
+	}
+	for _, tt := range tests {
+		be, err := LookupBackend(tt.name)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("LookupBackend(%q) error = %v, want %v", tt.name, err, tt.wantErr)
+		}
+		if err == nil && be.Name() != tt.name {
+			t.Errorf("LookupBackend(%q) = %s", tt.name, be.Name())
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package debpkg
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// stderrTail bounds how much of a child's stderr is kept for error messages.
+const stderrTail = 4 << 10
+
+// cmdReader streams a child process's stdout. The child's stderr is kept
+// apart and attached to the error if it exits non-zero, which the reader
+// then returns in place of io.EOF. Close kills a child that is still
+// running, so a consumer may stop reading at any point.
+type cmdReader struct {
+	cmd    *exec.Cmd
+	pr     *io.PipeReader
+	stdin  io.ReadCloser
+	stderr tailBuffer
+
+	done      chan struct{}
+	err       error
+	closeOnce sync.Once
+	killed    bool
+}
+
+// startCmd starts cmd with stdin (which may be nil) and returns a reader of
+// its stdout. stdin is owned by the returned reader and closed with it.
+func startCmd(cmd *exec.Cmd, stdin io.ReadCloser, notFound error) (io.ReadCloser, error) {
+	pr, pw := io.Pipe()
+	c := &cmdReader{cmd: cmd, pr: pr, stdin: stdin, done: make(chan struct{})}
+	if stdin != nil {
+		cmd.Stdin = stdin
+	}
+	cmd.Stdout = pw
+	cmd.Stderr = &c.stderr
+	if err := cmd.Start(); err != nil {
+		pw.Close()
+		if stdin != nil {
+			stdin.Close()
+		}
+		return nil, fmt.Errorf("%w: %v", notFound, err)
+	}
+
+	go func() {
+		err := cmd.Wait()
+		if err != nil {
+			err = c.describe(err)
+		}
+		// A failing upstream stage usually makes this one fail too, with a
+		// less useful message ("unexpected end of input"). Prefer its error.
+		// Nothing reads the upstream output any more, so an upstream stage
+		// that is still running would block forever writing it: Close kills
+		// it and only reports an error the stage hit by itself.
+		if up, ok := stdin.(*cmdReader); ok {
+			if upErr := up.Close(); upErr != nil {
+				err = upErr
+			}
+		}
+		c.err = err
+		pw.CloseWithError(err)
+		close(c.done)
+	}()
+	return c, nil
+}
+
+func (c *cmdReader) Read(p []byte) (int, error) {
+	return c.pr.Read(p)
+}
+
+// Close stops the child if needed and waits for it. An early stop by the
+// consumer is not an error; a child that had already failed is.
+func (c *cmdReader) Close() error {
+	c.closeOnce.Do(func() {
+		select {
+		case <-c.done:
+		default:
+			c.killed = true
+			_ = c.cmd.Process.Kill()
+		}
+		// Unblock the stdout copier in case the child is already gone but
+		// its output has not been drained.
+		c.pr.CloseWithError(errors.New("reader closed"))
+		if c.stdin != nil {
+			_ = c.stdin.Close()
+		}
+		<-c.done
+	})
+	if c.killed {
+		return nil
+	}
+	return c.err
+}
+
+func (c *cmdReader) describe(err error) error {
+	name := c.cmd.Args[0]
+	if len(c.cmd.Args) > 1 && c.cmd.Args[0] == "busybox" {
+		name += " " + c.cmd.Args[1]
+	}
+	msg := strings.TrimSpace(c.stderr.String())
+	if msg == "" {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return fmt.Errorf("%s: %w: %s", name, err, msg)
+}
+
+// tailBuffer keeps the last stderrTail bytes written to it.
+type tailBuffer struct {
+	mu  sync.Mutex
+	buf []byte
+}
+
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.buf = append(t.buf, p...)
+	if over := len(t.buf) - stderrTail; over > 0 {
+		t.buf = t.buf[over:]
+	}
+	return len(p), nil
+}
+
+func (t *tailBuffer) String() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return string(t.buf)
+}
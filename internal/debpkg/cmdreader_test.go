@@ -0,0 +1,102 @@
+package debpkg
+
+import (
+	"errors"
+	"io"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+var errTestNotFound = errors.New("test command not found")
+
+func pipeline(t *testing.T, stages ...[]string) io.ReadCloser {
+	t.Helper()
+	var r io.ReadCloser
+	for _, argv := range stages {
+		if _, err := exec.LookPath(argv[0]); err != nil {
+			t.Skipf("%s not available", argv[0])
+		}
+		next, err := startCmd(exec.Command(argv[0], argv[1:]...), r, errTestNotFound)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r = next
+	}
+	return r
+}
+
+// readAll drains r, failing the test if that takes too long.
+func readAll(t *testing.T, r io.Reader) ([]byte, error) {
+	t.Helper()
+	type result struct {
+		data []byte
+		err  error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		data, err := io.ReadAll(r)
+		ch <- result{data, err}
+	}()
+	select {
+	case res := <-ch:
+		return res.data, res.err
+	case <-time.After(10 * time.Second):
+		t.Fatal("pipeline hung")
+		return nil, nil
+	}
+}
+
+func TestCmdReaderPipeline(t *testing.T) {
+	tests := []struct {
+		name    string
+		stages  [][]string
+		want    string
+		wantErr string
+	}{
+		{"ok", [][]string{{"echo", "hello"}, {"cat"}}, "hello\n", ""},
+		{
+			"later stage fails while upstream still writes",
+			[][]string{{"cat", "/dev/zero"}, {"sh", "-c", "head -c 10 >/dev/null; echo corrupt input >&2; exit 3"}},
+			"", "corrupt input",
+		},
+		{
+			"upstream fails",
+			[][]string{{"sh", "-c", "echo truncated archive >&2; exit 2"}, {"cat"}},
+			"", "truncated archive",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := pipeline(t, tt.stages...)
+			data, err := readAll(t, r)
+			closeErr := r.Close()
+			if tt.wantErr == "" {
+				if err != nil || closeErr != nil {
+					t.Fatalf("read err = %v, close err = %v", err, closeErr)
+				}
+				if string(data) != tt.want {
+					t.Errorf("read %q, want %q", data, tt.want)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("read err = %v, want it to mention %q", err, tt.wantErr)
+			}
+			if closeErr == nil {
+				t.Error("Close returned nil after a failed stage")
+			}
+		})
+	}
+}
+
+func TestCmdReaderCloseEarly(t *testing.T) {
+	r := pipeline(t, []string{"cat", "/dev/zero"}, []string{"cat"})
+	if _, err := io.ReadFull(r, make([]byte, 4096)); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Close(); err != nil {
+		t.Errorf("Close after an early stop = %v, want nil", err)
+	}
+}
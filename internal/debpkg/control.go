@@ -0,0 +1,211 @@
+package debpkg
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+var ErrNoControl = errors.New("control file missing from control.tar")
+
+var maintainerScripts = map[string]bool{
+	"preinst":  true,
+	"postinst": true,
+	"prerm":    true,
+	"postrm":   true,
+	"config":   true,
+	"triggers": true,
+}
+
+// Control holds the fields of DEBIAN/control we care about. Fields keeps every
+// field verbatim, including the ones mirrored into the typed members.
+type Control struct {
+	Package       string            `json:"package"`
+	Version       string            `json:"version"`
+	Architecture  string            `json:"architecture"`
+	Depends       []string          `json:"depends,omitempty"`
+	InstalledSize int64             `json:"installed_size_kib"`
+	Fields        map[string]string `json:"fields"`
+}
+
+type PackageInfo struct {
+	Control Control `json:"control"`
+	// MD5Sums maps a path relative to the package root (no leading "./" or
+	// "/") to its lowercase hex digest.
+	MD5Sums   map[string]string `json:"md5sums"`
+	Conffiles []string          `json:"conffiles,omitempty"`
+	Scripts   map[string]string `json:"scripts,omitempty"`
+}
+
+// Inspect reads control.tar.* from debPath without touching data.tar.
+func Inspect(debPath string) (_ *PackageInfo, retErr error) {
+	if strings.TrimSpace(debPath) == "" {
+		return nil, ErrBadInput
+	}
+	f, err := os.Open(debPath)
+	if err != nil {
+		return nil, fmt.Errorf("open .deb: %w", err)
+	}
+	defer func() {
+		if cerr := f.Close(); cerr != nil && retErr == nil {
+			retErr = fmt.Errorf("close .deb: %w", cerr)
+		}
+	}()
+
+	name, body, err := findMember(bufio.NewReader(f), func(n string) bool { return strings.HasPrefix(n, "control.tar") })
+	if err != nil {
+		return nil, fmt.Errorf("find control.tar: %w", err)
+	}
+	tarStream, err := decompressMember(name, body)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return readControlTar(tar.NewReader(tarStream))
+}
+
+func decompressMember(name string, r io.Reader) (io.Reader, error) {
+	switch path.Ext(name) {
+	case ".xz":
+		return newGoXZReader(r)
+	case ".gz":
+		return gzip.NewReader(r)
+	case ".tar":
+		return r, nil
+	default:
+		return nil, fmt.Errorf("unsupported compression %q", path.Ext(name))
+	}
+}
+
+func readControlTar(tr *tar.Reader) (*PackageInfo, error) {
+	info := &PackageInfo{MD5Sums: map[string]string{}}
+	haveControl := false
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("tar next: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := strings.TrimPrefix(path.Clean(hdr.Name), "./")
+
+		switch {
+		case name == "control":
+			if info.Control, err = parseControl(tr); err != nil {
+				return nil, fmt.Errorf("parse control: %w", err)
+			}
+			haveControl = true
+		case name == "md5sums":
+			if info.MD5Sums, err = parseMD5Sums(tr); err != nil {
+				return nil, fmt.Errorf("parse md5sums: %w", err)
+			}
+		case name == "conffiles":
+			if info.Conffiles, err = readLines(tr); err != nil {
+				return nil, fmt.Errorf("read conffiles: %w", err)
+			}
+		case maintainerScripts[name]:
+			data, err := io.ReadAll(tr)
+			if err != nil {
+				return nil, fmt.Errorf("read %s: %w", name, err)
+			}
+			if info.Scripts == nil {
+				info.Scripts = map[string]string{}
+			}
+			info.Scripts[name] = string(data)
+		}
+	}
+	if !haveControl {
+		return nil, ErrNoControl
+	}
+	return info, nil
+}
+
+// parseControl reads a single deb822 paragraph. Continuation lines (leading
+// space or tab) are joined to the previous field with a newline, as dpkg does.
+func parseControl(r io.Reader) (Control, error) {
+	c := Control{Fields: map[string]string{}}
+	var last string
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := sc.Text()
+		if strings.TrimSpace(line) == "" {
+			if len(c.Fields) > 0 {
+				break
+			}
+			continue
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			if last == "" {
+				return c, fmt.Errorf("continuation line without field: %q", line)
+			}
+			c.Fields[last] += "\n" + strings.TrimSpace(line)
+			continue
+		}
+		key, val, ok := strings.Cut(line, ":")
+		if !ok {
+			return c, fmt.Errorf("malformed line: %q", line)
+		}
+		last = strings.TrimSpace(key)
+		c.Fields[last] = strings.TrimSpace(val)
+	}
+	if err := sc.Err(); err != nil {
+		return c, err
+	}
+
+	c.Package = c.Fields["Package"]
+	c.Version = c.Fields["Version"]
+	c.Architecture = c.Fields["Architecture"]
+	for _, dep := range strings.Split(c.Fields["Depends"], ",") {
+		if dep = strings.TrimSpace(dep); dep != "" {
+			c.Depends = append(c.Depends, dep)
+		}
+	}
+	if v := c.Fields["Installed-Size"]; v != "" {
+		sz, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return c, fmt.Errorf("Installed-Size %q: %w", v, err)
+		}
+		c.InstalledSize = sz
+	}
+	return c, nil
+}
+
+func parseMD5Sums(r io.Reader) (map[string]string, error) {
+	lines, err := readLines(r)
+	if err != nil {
+		return nil, err
+	}
+	sums := make(map[string]string, len(lines))
+	for _, line := range lines {
+		sum, name, ok := strings.Cut(line, " ")
+		if !ok || len(sum) != 32 {
+			return nil, fmt.Errorf("malformed line: %q", line)
+		}
+		// md5sum(1) separates with two spaces, or " *" in binary mode.
+		name = strings.TrimLeft(name, " *")
+		name = strings.TrimPrefix(path.Clean("/"+name), "/")
+		sums[name] = strings.ToLower(sum)
+	}
+	return sums, nil
+}
+
+func readLines(r io.Reader) ([]string, error) {
+	var out []string
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		if line := strings.TrimSpace(sc.Text()); line != "" {
+			out = append(out, line)
+		}
+	}
+	return out, sc.Err()
+}
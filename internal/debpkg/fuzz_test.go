@@ -0,0 +1,96 @@
+package debpkg
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/you/mullvad-installer/internal/ar"
+)
+
+func arMember(name string, body []byte) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%-16s%-12d%-6d%-6d%-8o%-10d`\n", name+"/", 0, 0, 0, 0o644, len(body))
+	b.Write(body)
+	if len(body)%2 != 0 {
+		b.WriteByte('\n')
+	}
+	return b.Bytes()
+}
+
+func tarOf(t testing.TB, hdrs ...*tar.Header) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	tw := tar.NewWriter(&b)
+	for _, h := range hdrs {
+		if h.Typeflag == tar.TypeReg {
+			h.Size = int64(len(h.Name))
+		}
+		if err := tw.WriteHeader(h); err != nil {
+			t.Fatal(err)
+		}
+		if h.Typeflag == tar.TypeReg {
+			if _, err := tw.Write([]byte(h.Name)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func FuzzFindDataTar(f *testing.F) {
+	deb := []byte(ar.Magic)
+	deb = append(deb, arMember("debian-binary", []byte("2.0\n"))...)
+	deb = append(deb, arMember("data.tar.xz", []byte("x"))...)
+	f.Add(deb)
+	f.Add(append([]byte(ar.Magic), arMember("control.tar.xz", []byte("abc"))...))
+	f.Add([]byte(ar.Magic + "data.tar.xz/    0           0     0     100644  -60       `\n"))
+	f.Add([]byte(ar.Magic + "//              0           0     0     0       14        `\ndata.tar.xz/\n\n/0              0           0     0     100644  1         `\nx\n"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		_, r, err := findDataTar(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+		if n, _ := io.Copy(io.Discard, r); n > int64(len(data)) {
+			t.Fatalf("member body %d bytes longer than input %d", n, len(data))
+		}
+	})
+}
+
+func FuzzExtractAll(f *testing.F) {
+	f.Add(tarOf(f,
+		&tar.Header{Name: "opt/", Typeflag: tar.TypeDir, Mode: 0o755},
+		&tar.Header{Name: "opt/a", Typeflag: tar.TypeReg, Mode: 0o644},
+	))
+	f.Add(tarOf(f,
+		&tar.Header{Name: "l", Typeflag: tar.TypeSymlink, Linkname: "/etc"},
+		&tar.Header{Name: "l/passwd", Typeflag: tar.TypeReg, Mode: 0o644},
+	))
+	f.Add(tarOf(f,
+		&tar.Header{Name: "up", Typeflag: tar.TypeSymlink, Linkname: "../.."},
+		&tar.Header{Name: "h", Typeflag: tar.TypeLink, Linkname: "../x"},
+	))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		root := t.TempDir()
+		dest := filepath.Join(root, "dest")
+		if err := os.Mkdir(dest, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		// Whatever the outcome, nothing may appear next to dest.
+		_ = extractAll(tar.NewReader(bytes.NewReader(data)), dest, Limits{MaxBytes: 1 << 20, MaxFiles: 64})
+		entries, err := os.ReadDir(root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 1 {
+			t.Fatalf("extraction escaped dest: %v", entries)
+		}
+	})
+}
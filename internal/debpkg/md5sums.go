@@ -0,0 +1,182 @@
+package debpkg
+
+import (
+	"archive/tar"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var (
+	ErrChecksumMismatch = errors.New("md5sum mismatch")
+	ErrNotInMD5Sums     = errors.New("file not listed in md5sums")
+	ErrMissingFile      = errors.New("file listed in md5sums missing from extraction")
+)
+
+// VerifyExtracted checks every regular file under root against info.MD5Sums.
+// Conffiles are allowed to be absent from md5sums, since debhelper leaves
+// them out.
+func VerifyExtracted(root string, info *PackageInfo) error {
+	conf := conffileSet(info)
+	seen := make(map[string]bool, len(info.MD5Sums))
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		want, ok := info.MD5Sums[rel]
+		if !ok {
+			if conf[rel] {
+				return nil
+			}
+			return fmt.Errorf("%w: %s", ErrNotInMD5Sums, rel)
+		}
+		seen[rel] = true
+
+		got, err := md5File(path)
+		if err != nil {
+			return err
+		}
+		if got != want {
+			return fmt.Errorf("%w: %s: got %s, want %s", ErrChecksumMismatch, rel, got, want)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var missing []string
+	for name := range info.MD5Sums {
+		if !seen[name] {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("%w: %s", ErrMissingFile, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+type verifySink struct {
+	next   Sink
+	sums   map[string]string
+	conf   map[string]bool
+	seen   map[string]bool
+	hashes map[string]string // digest of every regular file so far, for hard links
+}
+
+// NewVerifySink hashes regular files as they stream through to next and
+// fails on the first one that does not match info.MD5Sums. Done reports
+// listed files that never appeared. It is the streaming counterpart of
+// VerifyExtracted.
+func NewVerifySink(info *PackageInfo, next Sink) Sink {
+	return &verifySink{
+		next:   next,
+		sums:   info.MD5Sums,
+		conf:   conffileSet(info),
+		seen:   make(map[string]bool, len(info.MD5Sums)),
+		hashes: make(map[string]string, len(info.MD5Sums)),
+	}
+}
+
+func (v *verifySink) Entry(hdr *tar.Header, body io.Reader) error {
+	if hdr.Typeflag == tar.TypeLink {
+		return v.link(hdr, body)
+	}
+	if hdr.Typeflag != tar.TypeReg {
+		return v.next.Entry(hdr, body)
+	}
+	want, ok := v.sums[hdr.Name]
+	if !ok && !v.conf[hdr.Name] {
+		return fmt.Errorf("%w: %s", ErrNotInMD5Sums, hdr.Name)
+	}
+	v.seen[hdr.Name] = true
+
+	h := md5.New()
+	tee := io.TeeReader(body, h)
+	if err := v.next.Entry(hdr, tee); err != nil {
+		return err
+	}
+	// The sink may skip entries it does not install; hash them regardless.
+	if _, err := io.Copy(io.Discard, tee); err != nil {
+		return fmt.Errorf("read %s: %w", hdr.Name, err)
+	}
+	got := hex.EncodeToString(h.Sum(nil))
+	v.hashes[hdr.Name] = got
+	if ok && got != want {
+		return fmt.Errorf("%w: %s: got %s, want %s", ErrChecksumMismatch, hdr.Name, got, want)
+	}
+	return nil
+}
+
+// link checks a hard link by the content of its target, which tar always
+// stores earlier in the archive. md5sums lists the link like any file.
+func (v *verifySink) link(hdr *tar.Header, body io.Reader) error {
+	want, ok := v.sums[hdr.Name]
+	if !ok && !v.conf[hdr.Name] {
+		return fmt.Errorf("%w: %s", ErrNotInMD5Sums, hdr.Name)
+	}
+	got, known := v.hashes[hdr.Linkname]
+	if !known {
+		return fmt.Errorf("%w: hard link %s → %s: target is not an earlier regular file", ErrChecksumMismatch, hdr.Name, hdr.Linkname)
+	}
+	v.seen[hdr.Name] = true
+	v.hashes[hdr.Name] = got
+	if ok && got != want {
+		return fmt.Errorf("%w: %s: got %s, want %s", ErrChecksumMismatch, hdr.Name, got, want)
+	}
+	return v.next.Entry(hdr, body)
+}
+
+func (v *verifySink) Done() error {
+	var missing []string
+	for name := range v.sums {
+		if !v.seen[name] {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("%w: %s", ErrMissingFile, strings.Join(missing, ", "))
+	}
+	return v.next.Done()
+}
+
+func conffileSet(info *PackageInfo) map[string]bool {
+	conf := make(map[string]bool, len(info.Conffiles))
+	for _, c := range info.Conffiles {
+		conf[strings.TrimPrefix(filepath.Clean("/"+c), "/")] = true
+	}
+	return conf
+}
+
+func md5File(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("open %s: %w", path, err)
+	}
+	defer f.Close()
+
+	h := md5.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("hash %s: %w", path, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,126 @@
+package debpkg
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// sumOf is the md5sums entry for a tarOf file, whose content is its name.
+func sumOf(name string) string {
+	h := md5.Sum([]byte(name))
+	return hex.EncodeToString(h[:])
+}
+
+func reg(name string) *tar.Header {
+	return &tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0o644}
+}
+
+func hardLink(name, target string) *tar.Header {
+	return &tar.Header{Name: name, Typeflag: tar.TypeLink, Linkname: target, Mode: 0o644}
+}
+
+func TestVerifySink(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []*tar.Header
+		sums    map[string]string
+		conf    []string
+		wantErr error
+	}{
+		{
+			name:    "all listed",
+			entries: []*tar.Header{{Name: "usr/", Typeflag: tar.TypeDir, Mode: 0o755}, reg("usr/a"), reg("usr/b")},
+			sums:    map[string]string{"usr/a": sumOf("usr/a"), "usr/b": sumOf("usr/b")},
+		},
+		{
+			name:    "hard link listed with its target's content",
+			entries: []*tar.Header{reg("usr/a"), hardLink("usr/b", "usr/a")},
+			sums:    map[string]string{"usr/a": sumOf("usr/a"), "usr/b": sumOf("usr/a")},
+		},
+		{
+			name:    "hard link with wrong sum",
+			entries: []*tar.Header{reg("usr/a"), hardLink("usr/b", "usr/a")},
+			sums:    map[string]string{"usr/a": sumOf("usr/a"), "usr/b": sumOf("other")},
+			wantErr: ErrChecksumMismatch,
+		},
+		{
+			name:    "hard link to unknown target",
+			entries: []*tar.Header{hardLink("usr/b", "usr/a")},
+			sums:    map[string]string{"usr/b": sumOf("usr/a")},
+			wantErr: ErrChecksumMismatch,
+		},
+		{
+			name:    "hard link not listed",
+			entries: []*tar.Header{reg("usr/a"), hardLink("usr/b", "usr/a")},
+			sums:    map[string]string{"usr/a": sumOf("usr/a")},
+			wantErr: ErrNotInMD5Sums,
+		},
+		{
+			name:    "content mismatch",
+			entries: []*tar.Header{reg("usr/a")},
+			sums:    map[string]string{"usr/a": sumOf("tampered")},
+			wantErr: ErrChecksumMismatch,
+		},
+		{
+			name:    "file not listed",
+			entries: []*tar.Header{reg("usr/a"), reg("usr/extra")},
+			sums:    map[string]string{"usr/a": sumOf("usr/a")},
+			wantErr: ErrNotInMD5Sums,
+		},
+		{
+			name:    "unlisted conffile",
+			entries: []*tar.Header{reg("etc/mullvad.conf")},
+			sums:    map[string]string{},
+			conf:    []string{"/etc/mullvad.conf"},
+		},
+		{
+			name:    "listed file missing",
+			entries: []*tar.Header{reg("usr/a")},
+			sums:    map[string]string{"usr/a": sumOf("usr/a"), "usr/gone": sumOf("usr/gone")},
+			wantErr: ErrMissingFile,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info := &PackageInfo{MD5Sums: tt.sums, Conffiles: tt.conf}
+			sink := NewVerifySink(info, NewDirSink(t.TempDir(), true))
+			err := walkTar(tar.NewReader(bytes.NewReader(tarOf(t, tt.entries...))), Limits{}, sink)
+			if err == nil {
+				err = sink.Done()
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyExtracted(t *testing.T) {
+	data := tarOf(t,
+		&tar.Header{Name: "usr/", Typeflag: tar.TypeDir, Mode: 0o755},
+		reg("usr/a"),
+		hardLink("usr/b", "usr/a"),
+	)
+	sums := map[string]string{"usr/a": sumOf("usr/a"), "usr/b": sumOf("usr/a")}
+
+	dest := t.TempDir()
+	if err := extractAll(tar.NewReader(bytes.NewReader(data)), dest, Limits{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyExtracted(dest, &PackageInfo{MD5Sums: sums}); err != nil {
+		t.Fatalf("VerifyExtracted = %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dest, "usr/a"), []byte("tampered"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyExtracted(dest, &PackageInfo{MD5Sums: sums}); !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("after tampering VerifyExtracted = %v, want %v", err, ErrChecksumMismatch)
+	}
+}
@@ -0,0 +1,100 @@
+package debpkg
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	DefaultMaxBytes = 4 << 30
+	DefaultMaxFiles = 100_000
+)
+
+// Limits bounds what a single data.tar may unpack to. Zero fields fall back
+// to the defaults above, which leave ample room for the Mullvad package
+// (a few hundred MB, a few thousand files).
+type Limits struct {
+	MaxBytes int64
+	MaxFiles int
+}
+
+func (l Limits) withDefaults() Limits {
+	if l.MaxBytes <= 0 {
+		l.MaxBytes = DefaultMaxBytes
+	}
+	if l.MaxFiles <= 0 {
+		l.MaxFiles = DefaultMaxFiles
+	}
+	return l
+}
+
+// entryName normalises an archive name to a clean, relative, slash-separated
+// path. It returns "" for the archive root and an error for anything that
+// would climb out of the package.
+func entryName(name string) (string, error) {
+	if strings.Contains(name, "\x00") {
+		return "", fmt.Errorf("%w: %q", ErrPathOutside, name)
+	}
+	clean := strings.TrimPrefix(path.Clean("/"+name), "/")
+	if strings.Contains(name, "..") && !withinPkg(strings.TrimPrefix(name, "/")) {
+		return "", fmt.Errorf("%w: %q", ErrPathOutside, name)
+	}
+	return clean, nil
+}
+
+// checkNoSymlinks walks every existing component from dest down to dir and
+// fails if one of them is a symlink. An earlier entry can plant such a link
+// to redirect later writes, so this runs before every entry.
+func checkNoSymlinks(dest, dir string) error {
+	rel, err := filepath.Rel(dest, dir)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return fmt.Errorf("%w: %s", ErrPathOutside, dir)
+	}
+	if rel == "." {
+		return nil
+	}
+	cur := dest
+	for _, part := range strings.Split(rel, string(os.PathSeparator)) {
+		cur = filepath.Join(cur, part)
+		fi, err := os.Lstat(cur)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("lstat %s: %w", cur, err)
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("%w: %s", ErrSymlinkTraversal, cur)
+		}
+		if !fi.IsDir() {
+			return fmt.Errorf("%w: %s is not a directory", ErrPathOutside, cur)
+		}
+	}
+	return nil
+}
+
+// checkSymlinkTarget validates a symlink target lexically against the
+// package namespace: relative targets must resolve inside the package.
+// Absolute targets are left to the sink.
+func checkSymlinkTarget(name, target string) error {
+	if target == "" || strings.Contains(target, "\x00") {
+		return ErrBadLink
+	}
+	if path.IsAbs(target) {
+		return nil
+	}
+	if !withinPkg(path.Join(path.Dir(name), target)) {
+		return ErrBadLink
+	}
+	return nil
+}
+
+// withinPkg reports whether a relative, slash-separated path stays inside
+// the package root once cleaned.
+func withinPkg(p string) bool {
+	clean := path.Clean(p)
+	return clean != ".." && !strings.HasPrefix(clean, "../")
+}
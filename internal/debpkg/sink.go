@@ -0,0 +1,207 @@
+package debpkg
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/you/mullvad-installer/internal/fsmeta"
+)
+
+// Sink receives data.tar entries in archive order. hdr.Name (and Linkname
+// for hard links) is already clean, relative and slash-separated, limits
+// have been enforced and relative symlink targets are known to stay inside
+// the package. Done is called once after the last entry.
+type Sink interface {
+	Entry(hdr *tar.Header, body io.Reader) error
+	Done() error
+}
+
+func walkTar(tr *tar.Reader, lim Limits, sink Sink) error {
+	lim = lim.withDefaults()
+	var (
+		total int64
+		count int
+	)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("tar next: %w", err)
+		}
+
+		count++
+		if count > lim.MaxFiles {
+			return fmt.Errorf("%w: more than %d entries", ErrTooManyFiles, lim.MaxFiles)
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			if hdr.Size < 0 || hdr.Size > lim.MaxBytes-total {
+				return fmt.Errorf("%w: %s would exceed %d bytes", ErrTooLarge, hdr.Name, lim.MaxBytes)
+			}
+			total += hdr.Size
+		}
+
+		name, err := entryName(hdr.Name)
+		if err != nil {
+			return err
+		}
+		if name == "" {
+			continue
+		}
+		switch hdr.Typeflag {
+		case tar.TypeSymlink:
+			if err := checkSymlinkTarget(name, hdr.Linkname); err != nil {
+				return fmt.Errorf("%w: %s → %s", err, hdr.Name, hdr.Linkname)
+			}
+		case tar.TypeLink:
+			target, err := entryName(hdr.Linkname)
+			if err != nil || target == "" {
+				return fmt.Errorf("%w: %s → %s", ErrBadLink, hdr.Name, hdr.Linkname)
+			}
+			hdr.Linkname = target
+		}
+		hdr.Name = name
+
+		if err := sink.Entry(hdr, tr); err != nil {
+			return err
+		}
+	}
+}
+
+func extractAll(tr *tar.Reader, dest string, lim Limits) error {
+	sink := NewDirSink(dest, true)
+	if err := walkTar(tr, lim, sink); err != nil {
+		return err
+	}
+	return sink.Done()
+}
+
+// DirSink writes entries under a root directory with full metadata. It
+// never writes through a symlink, even one it created itself.
+type DirSink struct {
+	root   string
+	reroot bool
+	dirs   []dirMeta
+}
+
+type dirMeta struct {
+	path string
+	meta fsmeta.Meta
+}
+
+// NewDirSink returns a sink writing below root. With reroot set, absolute
+// symlink targets are placed under root, which keeps a scratch extraction
+// from pointing at the host; without it they are kept verbatim, as needed
+// when root is a staging area for the live system.
+func NewDirSink(root string, reroot bool) *DirSink {
+	return &DirSink{root: root, reroot: reroot}
+}
+
+func (s *DirSink) Entry(hdr *tar.Header, body io.Reader) error {
+	fullPath, err := s.writeContent(hdr, body)
+	if err != nil || fullPath == "" {
+		return err
+	}
+	meta := fsmeta.FromHeader(hdr)
+	if hdr.Typeflag == tar.TypeDir {
+		s.dirs = append(s.dirs, dirMeta{fullPath, meta})
+	}
+	return fsmeta.Apply(fullPath, meta)
+}
+
+// Done applies directory mtimes, deepest first, since writing children
+// bumps their parent's mtime.
+func (s *DirSink) Done() error {
+	for i := len(s.dirs) - 1; i >= 0; i-- {
+		if err := fsmeta.ApplyTimes(s.dirs[i].path, s.dirs[i].meta); err != nil {
+			return err
+		}
+	}
+	s.dirs = nil
+	return nil
+}
+
+func (s *DirSink) writeContent(hdr *tar.Header, body io.Reader) (_ string, retErr error) {
+	fullPath := filepath.Join(s.root, filepath.FromSlash(hdr.Name))
+	if err := checkNoSymlinks(s.root, filepath.Dir(fullPath)); err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(fullPath), defaultDirPerm); err != nil {
+		return "", fmt.Errorf("mkdir parent for %s: %w", fullPath, err)
+	}
+
+	// A later entry may replace an earlier one. Never follow what is there:
+	// drop old symlinks and refuse to turn one into a directory.
+	if fi, err := os.Lstat(fullPath); err == nil && fi.Mode()&os.ModeSymlink != 0 {
+		if hdr.Typeflag == tar.TypeDir {
+			return "", fmt.Errorf("%w: %s", ErrSymlinkTraversal, hdr.Name)
+		}
+		if err := os.Remove(fullPath); err != nil {
+			return "", fmt.Errorf("replace symlink %s: %w", fullPath, err)
+		}
+	}
+
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		if err := os.Mkdir(fullPath, defaultDirPerm); err != nil && !errors.Is(err, fs.ErrExist) {
+			return "", fmt.Errorf("mkdir %s: %w", fullPath, err)
+		}
+		return fullPath, nil
+
+	case tar.TypeSymlink:
+		target := hdr.Linkname
+		if s.reroot && filepath.IsAbs(target) {
+			target = filepath.Join(s.root, filepath.Clean(target))
+		}
+		_ = os.Remove(fullPath)
+		if err := os.Symlink(target, fullPath); err != nil {
+			return "", err
+		}
+		return fullPath, nil
+
+	case tar.TypeLink:
+		oldPath := filepath.Join(s.root, filepath.FromSlash(hdr.Linkname))
+		if err := checkNoSymlinks(s.root, filepath.Dir(oldPath)); err != nil {
+			return "", err
+		}
+		if fi, err := os.Lstat(oldPath); err != nil || !fi.Mode().IsRegular() {
+			return "", fmt.Errorf("%w: %s → %s: target is not a regular file", ErrBadLink, hdr.Name, hdr.Linkname)
+		}
+		_ = os.Remove(fullPath)
+		if err := os.Link(oldPath, fullPath); err != nil {
+			return "", fmt.Errorf("hard link %s: %w", fullPath, err)
+		}
+		return fullPath, nil
+
+	case tar.TypeReg, tar.TypeChar, tar.TypeBlock, tar.TypeFifo:
+		out, err := os.OpenFile(fullPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY|syscall.O_NOFOLLOW, hdr.FileInfo().Mode().Perm())
+		if err != nil {
+			return "", fmt.Errorf("open file %s: %w", fullPath, err)
+		}
+		defer func() {
+			if cerr := out.Close(); cerr != nil {
+				if retErr == nil {
+					retErr = fmt.Errorf("close %s: %w", fullPath, cerr)
+				} else {
+					fmt.Fprintf(os.Stderr, "warning: close %s: %v\n", fullPath, cerr)
+				}
+			}
+		}()
+		if hdr.Typeflag == tar.TypeReg {
+			if _, err := io.Copy(out, body); err != nil {
+				return "", fmt.Errorf("write file %s: %w", fullPath, err)
+			}
+		}
+		return fullPath, nil
+
+	default:
+		return "", nil
+	}
+}
@@ -0,0 +1,96 @@
+package fsmeta
+
+import (
+	"archive/tar"
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const paxXattrPrefix = "SCHILY.xattr."
+
+// Meta is the subset of inode metadata we carry from a package entry to the
+// installed file: owner, full mode including setuid/setgid/sticky, mtime and
+// extended attributes such as security.capability.
+type Meta struct {
+	Mode    os.FileMode
+	UID     int
+	GID     int
+	ModTime time.Time
+	Xattrs  map[string][]byte
+}
+
+func FromHeader(hdr *tar.Header) Meta {
+	m := Meta{
+		Mode:    hdr.FileInfo().Mode(),
+		UID:     hdr.Uid,
+		GID:     hdr.Gid,
+		ModTime: hdr.ModTime,
+	}
+	for k, v := range hdr.PAXRecords {
+		if name, ok := strings.CutPrefix(k, paxXattrPrefix); ok {
+			if m.Xattrs == nil {
+				m.Xattrs = make(map[string][]byte)
+			}
+			m.Xattrs[name] = []byte(v)
+		}
+	}
+	return m
+}
+
+func FromPath(path string) (Meta, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return Meta{}, err
+	}
+	m := Meta{
+		Mode:    info.Mode(),
+		ModTime: info.ModTime(),
+	}
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		m.UID = int(st.Uid)
+		m.GID = int(st.Gid)
+	}
+	if info.Mode()&os.ModeSymlink == 0 {
+		if m.Xattrs, err = readXattrs(path); err != nil {
+			return Meta{}, fmt.Errorf("xattrs %s: %w", path, err)
+		}
+	}
+	return m, nil
+}
+
+// Apply sets m on path. Ownership goes first because chown clears the
+// setuid/setgid bits and file capabilities; mode and xattrs follow so they
+// survive. Symlinks only get their owner, since Linux ignores their mode and
+// does not allow user xattrs on them.
+func Apply(path string, m Meta) error {
+	if err := os.Lchown(path, m.UID, m.GID); err != nil {
+		return fmt.Errorf("chown %s: %w", path, err)
+	}
+	if m.Mode&os.ModeSymlink != 0 {
+		return nil
+	}
+	if err := os.Chmod(path, m.Mode&(os.ModePerm|os.ModeSetuid|os.ModeSetgid|os.ModeSticky)); err != nil {
+		return fmt.Errorf("chmod %s: %w", path, err)
+	}
+	for name, val := range m.Xattrs {
+		if err := setXattr(path, name, val); err != nil {
+			return fmt.Errorf("setxattr %s on %s: %w", name, path, err)
+		}
+	}
+	return ApplyTimes(path, m)
+}
+
+// ApplyTimes sets the mtime alone. Directories need it done again once all
+// their children are written, since every write bumps the parent's mtime.
+func ApplyTimes(path string, m Meta) error {
+	if m.Mode&os.ModeSymlink != 0 || m.ModTime.IsZero() {
+		return nil
+	}
+	if err := os.Chtimes(path, m.ModTime, m.ModTime); err != nil {
+		return fmt.Errorf("chtimes %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package fsmeta
+
+import (
+	"bytes"
+	"errors"
+	"syscall"
+)
+
+func readXattrs(path string) (map[string][]byte, error) {
+	sz, err := syscall.Listxattr(path, nil)
+	if err != nil {
+		if errors.Is(err, syscall.ENOTSUP) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if sz == 0 {
+		return nil, nil
+	}
+	buf := make([]byte, sz)
+	if sz, err = syscall.Listxattr(path, buf); err != nil {
+		return nil, err
+	}
+
+	out := make(map[string][]byte)
+	for _, name := range bytes.Split(buf[:sz], []byte{0}) {
+		if len(name) == 0 {
+			continue
+		}
+		vsz, err := syscall.Getxattr(path, string(name), nil)
+		if err != nil {
+			return nil, err
+		}
+		val := make([]byte, vsz)
+		if vsz, err = syscall.Getxattr(path, string(name), val); err != nil {
+			return nil, err
+		}
+		out[string(name)] = val[:vsz]
+	}
+	return out, nil
+}
+
+func setXattr(path, name string, val []byte) error {
+	return syscall.Setxattr(path, name, val, 0)
+}
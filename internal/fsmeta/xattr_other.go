@@ -0,0 +1,11 @@
+//go:build !linux
+
+package fsmeta
+
+import "errors"
+
+func readXattrs(string) (map[string][]byte, error) { return nil, nil }
+
+func setXattr(string, string, []byte) error {
+	return errors.New("xattrs are only supported on linux")
+}
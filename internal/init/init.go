@@ -1,57 +1,187 @@
 package init
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 )
 
 type InitSystem string
 
 const (
-	Systemd InitSystem = "systemd"
-	Runit   InitSystem = "runit"
-	SysV    InitSystem = "sysvinit"
-	OpenRC  InitSystem = "openrc"
-	S6      InitSystem = "s6"
-	Dinit   InitSystem = "dinit"
-	Unknown InitSystem = "unknown"
+	Systemd  InitSystem = "systemd"
+	Runit    InitSystem = "runit"
+	SysV     InitSystem = "sysvinit"
+	OpenRC   InitSystem = "openrc"
+	S6       InitSystem = "s6"
+	Dinit    InitSystem = "dinit"
+	Shepherd InitSystem = "shepherd"
+	Finit    InitSystem = "finit"
+	Suite66  InitSystem = "66"
+	Unknown  InitSystem = "unknown"
 )
 
-func Detect() InitSystem {
-	procComm, _ := os.ReadFile("/proc/1/comm")
-	exePath, _ := os.Readlink("/proc/1/exe")
-	has := func(p string) bool { _, err := os.Stat(p); return err == nil }
+// Candidate is one init system that left traces on the machine.
+type Candidate struct {
+	System   InitSystem
+	Score    int
+	Evidence []string
+}
+
+// Detection is every candidate Detect found, best first, plus remarks
+// that apply to all of them.
+type Detection struct {
+	Candidates []Candidate
+	Notes      []string
+}
 
-	baseComm := strings.TrimSpace(string(procComm))
-	exeName := filepath.Base(exePath)
+// Best returns the highest scoring init system, or Unknown.
+func (d Detection) Best() InitSystem {
+	if len(d.Candidates) == 0 {
+		return Unknown
+	}
+	return d.Candidates[0].System
+}
 
+// Confidence is "high" when PID 1 or a running instance backs the best
+// candidate and nothing comes close, "medium" when it wins clearly on
+// weaker evidence, and "low" otherwise.
+func (d Detection) Confidence() string {
+	if len(d.Candidates) == 0 {
+		return "low"
+	}
+	best, margin := d.Candidates[0].Score, d.Candidates[0].Score
+	if len(d.Candidates) > 1 {
+		margin -= d.Candidates[1].Score
+	}
 	switch {
-	case baseComm == "systemd":
-		return Systemd
-	case contains([]string{"runit", "runsvinit", "runsvdir"}, []string{baseComm, exeName}) ||
-		(has("/etc/sv") && has("/etc/service")):
-		return Runit
-	case baseComm == "init" && has("/etc/init.d") && has("/etc/rc.d"):
-		return SysV
-	case baseComm == "openrc" || (has("/etc/init.d") && has("/run/openrc")):
-		return OpenRC
-	case baseComm == "s6-svscan" || has("/etc/s6"):
-		return S6
-	case baseComm == "dinit" || has("/etc/dinit"):
-		return Dinit
+	case best >= scorePID1 && margin >= scoreRuntime/2:
+		return "high"
+	case margin >= scoreConfig*2:
+		return "medium"
 	default:
-		return Unknown
+		return "low"
 	}
 }
 
-func contains(vals, tests []string) bool {
-	for _, t := range tests {
-		for _, v := range vals {
-			if t == v {
-				return true
-			}
+const (
+	scorePID1    = 100 // PID 1 is the init system's own binary
+	scoreRuntime = 60  // the init system's runtime state exists under /run
+	scoreConfig  = 10  // the init system's configuration is installed
+)
+
+// pid1Names maps PID 1 command and binary names to the init system they
+// belong to.
+var pid1Names = map[string]InitSystem{
+	"systemd":     Systemd,
+	"runit":       Runit,
+	"runit-init":  Runit,
+	"runsvdir":    Runit,
+	"runsvinit":   Runit,
+	"openrc-init": OpenRC,
+	"s6-svscan":   S6,
+	"dinit":       Dinit,
+	"shepherd":    Shepherd,
+	"finit":       Finit,
+}
+
+type probe struct {
+	sys   InitSystem
+	path  string
+	score int
+	why   string
+}
+
+var probes = []probe{
+	{Systemd, "run/systemd/system", scoreRuntime + 20, "systemd is running (/run/systemd/system)"},
+	// 66 runs on top of s6-svscan as PID 1, so a live 66 has to outweigh
+	// that PID 1 evidence for s6.
+	{Suite66, "run/66", scorePID1 + scoreRuntime, "66 manages the supervision tree (/run/66)"},
+	{OpenRC, "run/openrc", scoreRuntime + 20, "OpenRC has booted this system (/run/openrc)"},
+	{Runit, "run/runit", scoreRuntime, "runit runtime state (/run/runit)"},
+	{S6, "run/s6", scoreRuntime, "s6 runtime state (/run/s6)"},
+	{S6, "run/s6-rc", scoreRuntime, "s6-rc live database (/run/s6-rc)"},
+	{Dinit, "run/dinitctl", scoreRuntime, "dinit control socket (/run/dinitctl)"},
+	{SysV, "run/initctl", scoreRuntime / 2, "sysvinit control FIFO (/run/initctl)"},
+	{Shepherd, "var/run/shepherd/socket", scoreRuntime, "Shepherd control socket (/var/run/shepherd/socket)"},
+	{Finit, "run/finit", scoreRuntime, "finit runtime state (/run/finit)"},
+
+	{Systemd, "etc/systemd/system", scoreConfig, "/etc/systemd/system exists"},
+	{Runit, "etc/sv", scoreConfig, "/etc/sv exists"},
+	{Runit, "etc/runit", scoreConfig, "/etc/runit exists"},
+	{OpenRC, "etc/runlevels", scoreConfig + 5, "/etc/runlevels exists"},
+	{SysV, "etc/inittab", scoreConfig, "/etc/inittab exists"},
+	{S6, "etc/s6", scoreConfig, "/etc/s6 exists"},
+	{S6, "etc/s6-rc", scoreConfig, "/etc/s6-rc exists"},
+	{Dinit, "etc/dinit.d", scoreConfig, "/etc/dinit.d exists"},
+	{Shepherd, "etc/shepherd", scoreConfig, "/etc/shepherd exists"},
+	{Finit, "etc/finit.conf", scoreConfig, "/etc/finit.conf exists"},
+	{Finit, "etc/finit.d", scoreConfig, "/etc/finit.d exists"},
+	{Suite66, "etc/66", scoreConfig, "/etc/66 exists"},
+}
+
+// Detect inspects the running system.
+func Detect() Detection { return DetectIn("/") }
+
+// DetectIn scores every init system by what it finds under root: what PID 1
+// is, which init systems have runtime state under /run, and which are
+// merely installed. Several init packages may be installed side by side,
+// so installed files alone never outweigh a running instance.
+func DetectIn(root string) Detection {
+	scores := map[InitSystem]*Candidate{}
+	add := func(sys InitSystem, score int, why string) {
+		c, ok := scores[sys]
+		if !ok {
+			c = &Candidate{System: sys}
+			scores[sys] = c
+		}
+		c.Score += score
+		c.Evidence = append(c.Evidence, fmt.Sprintf("%s (+%d)", why, score))
+	}
+	var d Detection
+
+	comm, _ := os.ReadFile(filepath.Join(root, "proc/1/comm"))
+	exe, _ := os.Readlink(filepath.Join(root, "proc/1/exe"))
+	baseComm := strings.TrimSpace(string(comm))
+	exeName := filepath.Base(exe)
+
+	if sys, ok := pid1Names[baseComm]; ok {
+		add(sys, scorePID1, fmt.Sprintf("PID 1 is %s", baseComm))
+	} else if sys, ok := pid1Names[exeName]; ok && exe != "" {
+		add(sys, scorePID1, fmt.Sprintf("PID 1 runs %s", exe))
+	} else if baseComm == "init" {
+		// sysvinit, busybox init, and sysvinit booting OpenRC all look
+		// like this; the runtime probes decide between them.
+		add(SysV, scorePID1*2/5, "PID 1 is a generic init")
+		add(OpenRC, scorePID1/5, "PID 1 is a generic init, OpenRC runs under it")
+	} else if baseComm != "" {
+		d.Notes = append(d.Notes, fmt.Sprintf("PID 1 is %q, which is not an init system", baseComm))
+	}
+
+	for _, p := range probes {
+		if _, err := os.Lstat(filepath.Join(root, p.path)); err == nil {
+			add(p.sys, p.score, p.why)
+		}
+	}
+
+	for _, f := range []string{".dockerenv", "run/.containerenv"} {
+		if _, err := os.Stat(filepath.Join(root, f)); err == nil {
+			d.Notes = append(d.Notes, "running in a container (/"+f+"); the host's init system does not apply")
+			break
 		}
 	}
-	return false
+
+	for _, c := range scores {
+		d.Candidates = append(d.Candidates, *c)
+	}
+	sort.Slice(d.Candidates, func(i, j int) bool {
+		a, b := d.Candidates[i], d.Candidates[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		return a.System < b.System
+	})
+	return d
 }
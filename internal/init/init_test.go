@@ -0,0 +1,170 @@
+package init
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fixture builds a fake root: entries ending in "/" are directories,
+// "proc/1/exe" is a symlink to its value, everything else a file.
+func fixture(t *testing.T, entries map[string]string) string {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range entries {
+		p := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		var err error
+		switch {
+		case name[len(name)-1] == '/':
+			err = os.MkdirAll(p, 0o755)
+		case name == "proc/1/exe":
+			err = os.Symlink(content, p)
+		default:
+			err = os.WriteFile(p, []byte(content), 0o644)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestDetectIn(t *testing.T) {
+	tests := []struct {
+		name       string
+		entries    map[string]string
+		want       InitSystem
+		confidence string
+	}{
+		{
+			name: "systemd",
+			entries: map[string]string{
+				"proc/1/comm":         "systemd\n",
+				"proc/1/exe":          "/usr/lib/systemd/systemd",
+				"run/systemd/system/": "",
+				"etc/systemd/system/": "",
+				"etc/init.d/":         "",
+			},
+			want:       Systemd,
+			confidence: "high",
+		},
+		{
+			name: "artix runit with other init packages installed",
+			entries: map[string]string{
+				"proc/1/comm":         "runit\n",
+				"etc/runit/sv/":       "",
+				"etc/systemd/system/": "",
+				"etc/dinit.d/":        "",
+				"etc/s6/":             "",
+			},
+			want:       Runit,
+			confidence: "high",
+		},
+		{
+			name: "openrc booted by sysvinit",
+			entries: map[string]string{
+				"proc/1/comm":    "init\n",
+				"proc/1/exe":     "/sbin/init",
+				"run/openrc/":    "",
+				"run/initctl":    "",
+				"etc/inittab":    "",
+				"etc/runlevels/": "",
+			},
+			want:       OpenRC,
+			confidence: "high",
+		},
+		{
+			name: "plain sysvinit",
+			entries: map[string]string{
+				"proc/1/comm": "init\n",
+				"run/initctl": "",
+				"etc/inittab": "",
+			},
+			want:       SysV,
+			confidence: "medium",
+		},
+		{
+			name: "pid 1 found by binary name",
+			entries: map[string]string{
+				"proc/1/comm":  "init\n",
+				"proc/1/exe":   "/usr/bin/dinit",
+				"run/dinitctl": "",
+			},
+			want:       Dinit,
+			confidence: "high",
+		},
+		{
+			name: "guix shepherd",
+			entries: map[string]string{
+				"proc/1/comm":             "shepherd\n",
+				"var/run/shepherd/socket": "",
+			},
+			want:       Shepherd,
+			confidence: "high",
+		},
+		{
+			name: "finit",
+			entries: map[string]string{
+				"proc/1/comm":    "finit\n",
+				"run/finit/":     "",
+				"etc/finit.d/":   "",
+				"etc/init.d/":    "",
+				"etc/inittab":    "",
+				"etc/runlevels/": "",
+			},
+			want:       Finit,
+			confidence: "high",
+		},
+		{
+			name: "66 on s6",
+			entries: map[string]string{
+				"proc/1/comm": "s6-svscan\n",
+				"run/66/":     "",
+				"etc/66/":     "",
+				"etc/s6/":     "",
+			},
+			want:       Suite66,
+			confidence: "high",
+		},
+		{
+			name: "container",
+			entries: map[string]string{
+				"proc/1/comm":         "bash\n",
+				".dockerenv":          "",
+				"etc/systemd/system/": "",
+			},
+			want:       Systemd,
+			confidence: "low",
+		},
+		{
+			name:       "nothing",
+			entries:    map[string]string{},
+			want:       Unknown,
+			confidence: "low",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := DetectIn(fixture(t, tt.entries))
+			if got := d.Best(); got != tt.want {
+				t.Errorf("Best() = %s, want %s; candidates %+v", got, tt.want, d.Candidates)
+			}
+			if got := d.Confidence(); got != tt.confidence {
+				t.Errorf("Confidence() = %s, want %s; candidates %+v", got, tt.confidence, d.Candidates)
+			}
+		})
+	}
+}
+
+func TestDetectInContainerNote(t *testing.T) {
+	d := DetectIn(fixture(t, map[string]string{
+		"proc/1/comm": "sleep\n",
+		".dockerenv":  "",
+	}))
+	if len(d.Notes) != 2 {
+		t.Fatalf("Notes = %q, want PID 1 and container notes", d.Notes)
+	}
+}
@@ -23,7 +23,6 @@ func Install(
 	osInfo arch.OSInfo,
 	cfg *config.Config,
 	u *ui.UI,
-	useSystemXZ bool,
 ) error {
 	assetURL, err := selectDebAsset(rel, osInfo.Arch)
 	if err != nil {
@@ -68,33 +67,69 @@ func Install(
 		ui.Info("PGP signature OK")
 	}
 
-	extractDir := filepath.Join(tmpDir, "ex")
+	policy := NewPathPolicy(cfg)
 	if cfg.DryRun {
-		ui.Info("(dry-run) would extract .deb from", debPath, "to", extractDir)
-	} else {
-		if err := debpkg.ExtractDeb(debPath, extractDir, useSystemXZ); err != nil {
-			return fmt.Errorf("extract .deb: %w", err)
+		for _, line := range policy.describe() {
+			ui.Info("(dry-run) would install ", line)
 		}
-		ui.Info("Extracted .deb to", extractDir)
+		return nil
 	}
 
-	for _, pair := range []struct{ src, dst string }{
-		{filepath.Join(extractDir, "opt"), "/opt"},
-		{filepath.Join(extractDir, "usr"), "/usr"},
-	} {
-		if cfg.DryRun {
-			ui.Info("(dry-run) would copy tree from", pair.src, "to", pair.dst)
-		} else {
-			ui.Info("Installing tree from", pair.src, "→", pair.dst)
-			if err := installTree(pair.src, pair.dst, cfg); err != nil {
-				return err
-			}
-		}
+	info, err := debpkg.Inspect(debPath)
+	if err != nil {
+		return fmt.Errorf("read control: %w", err)
+	}
+	be, err := chooseBackend(debPath, cfg.Extractor)
+	if err != nil {
+		return err
 	}
 
+	// Files go straight from the decompressor into staging directories on
+	// the target filesystems; nothing is committed until every md5sum has
+	// been checked.
+	stage := newStagingSink(policy)
+	defer stage.discard()
+	if err := debpkg.Stream(debPath, be, debpkg.Limits{
+		MaxBytes: cfg.MaxExtractBytes,
+		MaxFiles: cfg.MaxExtractFiles,
+	}, debpkg.NewVerifySink(info, stage)); err != nil {
+		return fmt.Errorf("unpack .deb: %w", err)
+	}
+	ui.Info(fmt.Sprintf("Verified %d files against md5sums", len(info.MD5Sums)))
+
+	if err := Guard(stage.commit); err != nil {
+		return fmt.Errorf("commit staged files: %w", err)
+	}
 	return nil
 }
 
+func chooseBackend(debPath, name string) (debpkg.Backend, error) {
+	if name != "" && name != debpkg.BackendAuto {
+		be, err := debpkg.LookupBackend(name)
+		if err != nil {
+			return nil, fmt.Errorf("extractor: %w", err)
+		}
+		ui.Info("Extractor:", be.Description())
+		return be, nil
+	}
+
+	be, results := debpkg.PickBackend(debPath)
+	for _, r := range results {
+		if r.Err != nil {
+			ui.Warn(fmt.Sprintf("extractor %s failed benchmark: %v", r.Backend.Name(), r.Err))
+			continue
+		}
+		mbps := float64(r.Bytes) / 1024 / 1024 / r.Elapsed.Seconds()
+		ui.Info(fmt.Sprintf("Extractor %s: %.1f MB/s", r.Backend.Name(), mbps))
+	}
+	if len(results) == 0 {
+		ui.Info("Using extractor from an earlier benchmark:", be.Description())
+		return be, nil
+	}
+	ui.Info("Using extractor:", be.Description())
+	return be, nil
+}
+
 func selectDebAsset(rel *github.Release, arch string) (string, error) {
 	for _, a := range rel.Assets {
 		if strings.Contains(a.Name, arch+".deb") {
@@ -135,54 +170,6 @@ func fetchFile(
 	return nil
 }
 
-func installTree(src, dst string, cfg *config.Config) error {
-	return filepath.WalkDir(src, func(path string, d os.DirEntry, err error) error {
-		if err != nil {
-			return err
-		}
-		rel, _ := filepath.Rel(src, path)
-		target := filepath.Join(dst, rel)
-		info, err := d.Info()
-		if err != nil {
-			return err
-		}
-
-		if d.IsDir() {
-			if cfg.DryRun {
-				ui.Info(fmt.Sprintf("(dry-run) mkdir %s", target))
-				return nil
-			}
-			return os.MkdirAll(target, info.Mode())
-		}
-
-		ui.Info("Installing file", target)
-		if cfg.DryRun {
-			return nil
-		}
-		return copyFileWithMode(path, target, info.Mode())
-	})
-}
-
-func copyFileWithMode(src, dst string, mode os.FileMode) error {
-	in, err := os.Open(src)
-	if err != nil {
-		return fmt.Errorf("open src %s: %w", src, err)
-	}
-	defer in.Close()
-
-	out, err := os.OpenFile(dst,
-		os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
-	if err != nil {
-		return fmt.Errorf("open dst %s: %w", dst, err)
-	}
-	defer out.Close()
-
-	if _, err := io.Copy(out, in); err != nil {
-		return fmt.Errorf("copy %s→%s: %w", src, dst, err)
-	}
-	return nil
-}
-
 type progressReader struct {
 	reader    io.Reader
 	total     int64
@@ -219,41 +206,35 @@ func (p *progressReader) finishPrint() {
 	ui.FinishProgress(p.read, p.total, elapsed)
 }
 
+// SetupService installs, enables and starts the daemon under initSys, then
+// waits for it to come up healthy. In dry-run mode it lists the files that
+// would be written instead.
 func SetupService(initSys initpkg.InitSystem, cfg *config.Config) error {
-	if cfg.DryRun {
-		switch initSys {
-		case initpkg.Systemd:
-			ui.Info("(dry-run) would install systemd unit")
-		case initpkg.Runit:
-			ui.Info("(dry-run) would install runit service")
-		case initpkg.SysV:
-			ui.Info("(dry-run) would install sysvinit script")
-		case initpkg.OpenRC:
-			ui.Info("(dry-run) would install openrc service")
-		case initpkg.S6:
-			ui.Info("(dry-run) would install s6 service")
-		case initpkg.Dinit:
-			ui.Info("(dry-run) would install dinit unit")
-		default:
-			ui.Info("(dry-run) unsupported init system, would skip")
-		}
+	p := service.ParamsFromConfig(cfg)
+	b, err := service.Lookup(initSys, p)
+	if err != nil {
+		ui.Info(fmt.Sprintf("Unsupported init system %q, skipping service setup", initSys))
 		return nil
 	}
 
-	switch initSys {
-	case initpkg.Systemd,
-		initpkg.Runit,
-		initpkg.SysV,
-		initpkg.OpenRC,
-		initpkg.S6,
-		initpkg.Dinit:
-		if err := service.SetupService(cfg); err != nil {
-			return fmt.Errorf("service setup for %s failed: %w", initSys, err)
+	if cfg.DryRun {
+		files, err := b.Render()
+		if err != nil {
+			return fmt.Errorf("render %s service: %w", initSys, err)
+		}
+		for _, f := range files {
+			ui.Info(fmt.Sprintf("(dry-run) would write %s (%d bytes)", f.Path, len(f.Data)))
 		}
-		ui.Info("Service for %s installed and started", initSys)
+		ui.Info(fmt.Sprintf("(dry-run) would enable and start %s under %s", service.DaemonName, initSys))
 		return nil
-	default:
-		ui.Info("Unsupported init system %q, skipping service setup", initSys)
+	}
+
+	if err := Guard(func() error { return service.Setup(b) }); err != nil {
+		return fmt.Errorf("service setup for %s failed: %w", initSys, err)
+	}
+	ui.Info(fmt.Sprintf("Service for %s installed and started", initSys))
+	if cfg.HealthTimeout <= 0 {
 		return nil
 	}
+	return service.WaitHealthy(b, p, cfg.HealthTimeout)
 }
@@ -0,0 +1,97 @@
+package installer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/you/mullvad-installer/internal/config"
+	"github.com/you/mullvad-installer/internal/ui"
+)
+
+// defaultTops are the top-level package directories installed unless the
+// config says otherwise. Anything else a package ships is reported and left
+// out, so new upstream directories never go missing silently. Files under
+// /etc are conffiles: commit keeps the admin's edits to them.
+var defaultTops = []string{"bin", "etc", "lib", "lib32", "lib64", "opt", "sbin", "usr", "var"}
+
+// PathPolicy decides, per top-level package directory, where it goes on the
+// live system or whether it is skipped.
+type PathPolicy struct {
+	targets map[string]string
+	skip    map[string]bool
+}
+
+// NewPathPolicy starts from defaultTops, each mapped to the same path on the
+// host, then applies cfg's --map-path and --skip-path overrides. A default
+// target that is a symlink on the host (/lib → usr/lib on merged-/usr
+// systems, /sbin → usr/bin on Arch) is resolved so files land in the real
+// directory instead of replacing the link's contents piecemeal.
+func NewPathPolicy(cfg *config.Config) PathPolicy {
+	p := PathPolicy{
+		targets: make(map[string]string, len(defaultTops)),
+		skip:    map[string]bool{},
+	}
+	for _, top := range defaultTops {
+		p.targets[top] = resolveHostDir("/" + top)
+	}
+	for top, dst := range cfg.PathMap {
+		p.targets[top] = filepath.Clean(dst)
+	}
+	for _, top := range cfg.SkipPaths {
+		p.skip[top] = true
+	}
+	return p
+}
+
+// Target returns where top installs to. ok is false for skipped and for
+// unmapped directories; skipped tells them apart.
+func (p PathPolicy) Target(top string) (target string, skipped, ok bool) {
+	if p.skip[top] {
+		return "", true, false
+	}
+	target, ok = p.targets[top]
+	return target, false, ok
+}
+
+func (p PathPolicy) describe() []string {
+	var out []string
+	for top, dst := range p.targets {
+		if !p.skip[top] {
+			out = append(out, fmt.Sprintf("%s/ → %s", top, dst))
+		}
+	}
+	for top := range p.skip {
+		out = append(out, fmt.Sprintf("%s/ skipped", top))
+	}
+	sort.Strings(out)
+	return out
+}
+
+func resolveHostDir(dir string) string {
+	fi, err := os.Lstat(dir)
+	if err != nil || fi.Mode()&os.ModeSymlink == 0 {
+		return dir
+	}
+	real, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return dir
+	}
+	if real != dir {
+		ui.Info(fmt.Sprintf("%s is a symlink to %s, installing there", dir, real))
+	}
+	return real
+}
+
+// logUnmapped reports package directories that were neither mapped nor
+// explicitly skipped.
+func logUnmapped(tops []string) {
+	if len(tops) == 0 {
+		return
+	}
+	sort.Strings(tops)
+	ui.Warn(fmt.Sprintf("package directories not installed (no mapping): %s/; use --map-path or --skip-path",
+		strings.Join(tops, "/, ")))
+}
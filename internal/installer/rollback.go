@@ -0,0 +1,208 @@
+package installer
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/you/mullvad-installer/internal/config"
+	initpkg "github.com/you/mullvad-installer/internal/init"
+	"github.com/you/mullvad-installer/internal/remove"
+	"github.com/you/mullvad-installer/internal/service"
+	"github.com/you/mullvad-installer/internal/ui"
+)
+
+const backupSuffix = ".mullvad-rollback"
+
+// Backup keeps the previous installation aside while a new one is tried.
+// Each installed path is renamed next to itself, which stays on the same
+// filesystem and is cheap even for /opt/Mullvad VPN. Conffiles and the
+// install manifest are copied instead, since the new install reads them.
+type Backup struct {
+	moved          []string
+	svc            service.Backend
+	restoreService func() error
+	wasInstalled   bool
+	wasRunning     bool
+	done           bool // restored or discarded
+}
+
+// liveMu serialises changes to the live installation with the interrupt
+// handler, which restores pending, the installation set aside and neither
+// restored nor discarded yet, before exiting.
+var (
+	liveMu  sync.Mutex
+	pending *Backup
+)
+
+// Guard runs fn, which changes the live installation, to completion before
+// an interrupt may restore the previous one.
+func Guard(fn func() error) error {
+	liveMu.Lock()
+	defer liveMu.Unlock()
+	return fn()
+}
+
+// restorePending puts back the installation set aside, if any, when the
+// installer is interrupted.
+func restorePending() {
+	liveMu.Lock()
+	bk := pending
+	liveMu.Unlock()
+	if bk == nil {
+		return
+	}
+	ui.Warn("Interrupted")
+	if err := bk.Restore(); err != nil {
+		ui.Warn(fmt.Sprintf("restoring the previous installation failed: %v", err))
+	}
+}
+
+// BackupPrevious sets the current installation and its service files
+// aside. It must run before remove.Remove, which would delete them.
+func BackupPrevious(cfg *config.Config, initSys initpkg.InitSystem) (*Backup, error) {
+	liveMu.Lock()
+	defer liveMu.Unlock()
+	bk := &Backup{}
+	if b, err := service.Lookup(initSys, service.ParamsFromConfig(cfg)); err == nil {
+		restore, err := service.Snapshot(b)
+		if err != nil {
+			return nil, fmt.Errorf("back up service files: %w", err)
+		}
+		bk.svc, bk.restoreService = b, restore
+		bk.wasRunning, _ = b.Status()
+	}
+	paths, err := remove.Installed()
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range append(paths, remove.ManifestPath) {
+		if _, err := os.Lstat(path); os.IsNotExist(err) {
+			continue
+		}
+		_ = os.RemoveAll(path + backupSuffix)
+		setAside := os.Rename
+		if service.IsConffile(path) || path == remove.ManifestPath {
+			setAside = copyFile
+		}
+		if err := setAside(path, path+backupSuffix); err != nil {
+			return nil, errors.Join(fmt.Errorf("back up %s: %w", path, err), bk.putBack())
+		}
+		bk.moved = append(bk.moved, path)
+	}
+	bk.wasInstalled = len(bk.moved) > 0
+	pending = bk
+	ui.Info(fmt.Sprintf("Previous installation set aside (%d paths)", len(bk.moved)))
+	return bk, nil
+}
+
+// Restore tears down the new service, puts the previous files back and
+// brings the previous service up again if it was running. After a first
+// install it only cleans up. Restoring twice does nothing.
+func (bk *Backup) Restore() error {
+	liveMu.Lock()
+	defer liveMu.Unlock()
+	if bk.done {
+		return nil
+	}
+	bk.done, pending = true, nil
+	ui.Warn("Restoring the previous installation")
+	if bk.svc != nil {
+		service.Teardown(bk.svc, false)
+	}
+	errs := []error{bk.removeNew(), bk.putBack()}
+	if bk.svc != nil {
+		errs = append(errs, bk.restoreService(), service.Reload(bk.svc))
+		if bk.wasInstalled {
+			errs = append(errs, bk.svc.Enable())
+		}
+		if bk.wasRunning {
+			errs = append(errs, bk.svc.Start())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// removeNew deletes the files the failed install added that the previous
+// one did not have.
+func (bk *Backup) removeNew() error {
+	files, _, err := remove.ReadManifest()
+	if err != nil {
+		return err
+	}
+	had := map[string]bool{}
+	for _, path := range bk.moved {
+		had[path] = true
+	}
+	var errs []error
+	for _, path := range files {
+		if had[path] {
+			continue
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (bk *Backup) putBack() error {
+	var errs []error
+	for _, path := range bk.moved {
+		// Removing the new install may have taken the directory with it.
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := os.RemoveAll(path); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := os.Rename(path+backupSuffix, path); err != nil {
+			errs = append(errs, fmt.Errorf("restore %s: %w", path, err))
+		}
+	}
+	bk.moved = nil
+	return errors.Join(errs...)
+}
+
+// Discard deletes the previous installation once the new one is healthy.
+func (bk *Backup) Discard() {
+	liveMu.Lock()
+	defer liveMu.Unlock()
+	if bk.done {
+		return
+	}
+	bk.done, pending = true, nil
+	for _, path := range bk.moved {
+		if err := os.RemoveAll(path + backupSuffix); err != nil {
+			ui.Warn(fmt.Sprintf("remove backup %s: %v", path+backupSuffix, err))
+		}
+	}
+	bk.moved = nil
+}
+
+// copyFile copies the file or symlink src to dst, keeping its permissions.
+func copyFile(src, dst string) error {
+	fi, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+	if fi.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(src)
+		if err != nil {
+			return err
+		}
+		return os.Symlink(target, dst)
+	}
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(dst, data, fi.Mode().Perm()); err != nil {
+		return err
+	}
+	return os.Chmod(dst, fi.Mode().Perm())
+}
@@ -0,0 +1,106 @@
+package installer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/you/mullvad-installer/internal/config"
+	"github.com/you/mullvad-installer/internal/remove"
+)
+
+func TestBackupRestore(t *testing.T) {
+	setManifest(t)
+	root := t.TempDir()
+	oldPaths := remove.Paths
+	t.Cleanup(func() { remove.Paths = oldPaths })
+	app := filepath.Join(root, "opt", "app")
+	remove.Paths = []string{app}
+
+	write := func(path, data string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	lib := filepath.Join(root, "usr", "lib", "mullvad", "old.so")
+	write(filepath.Join(app, "bin"), "old app")
+	write(lib, "old lib")
+	if err := remove.Record([]string{lib}, []string{filepath.Dir(lib)}); err != nil {
+		t.Fatal(err)
+	}
+
+	bk, err := BackupPrevious(&config.Config{}, "none")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{app, lib} {
+		if _, err := os.Lstat(p); !os.IsNotExist(err) {
+			t.Errorf("%s still in place after backup: %v", p, err)
+		}
+	}
+
+	// The new install replaces the app and adds a file of its own.
+	added := filepath.Join(root, "usr", "lib", "mullvad", "new.so")
+	write(filepath.Join(app, "bin"), "new app")
+	write(added, "new lib")
+	if err := remove.Record([]string{added}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := bk.Restore(); err != nil {
+		t.Fatal(err)
+	}
+	for path, want := range map[string]string{filepath.Join(app, "bin"): "old app", lib: "old lib"} {
+		if data, err := os.ReadFile(path); err != nil || string(data) != want {
+			t.Errorf("%s = %q, %v; want %q", path, data, err, want)
+		}
+	}
+	if _, err := os.Lstat(added); !os.IsNotExist(err) {
+		t.Errorf("%s left behind by restore: %v", added, err)
+	}
+	if files, _, _ := remove.ReadManifest(); len(files) != 1 || files[0] != lib {
+		t.Errorf("manifest after restore = %v, want [%s]", files, lib)
+	}
+	if left, _ := filepath.Glob(filepath.Join(root, "*", "*"+backupSuffix)); len(left) != 0 {
+		t.Errorf("backups left behind: %v", left)
+	}
+}
+
+func TestRestorePending(t *testing.T) {
+	setManifest(t)
+	oldPaths := remove.Paths
+	t.Cleanup(func() { remove.Paths = oldPaths })
+	bin := filepath.Join(t.TempDir(), "mullvad-daemon")
+	remove.Paths = []string{bin}
+	if err := os.WriteFile(bin, []byte("old"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	bk, err := BackupPrevious(&config.Config{}, "none")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// An interrupt now must not leave the machine without a daemon.
+	restorePending()
+	if data, err := os.ReadFile(bin); err != nil || string(data) != "old" {
+		t.Errorf("%s = %q, %v after interrupt; want %q", bin, data, err, "old")
+	}
+	if pending != nil {
+		t.Error("backup still pending after restore")
+	}
+
+	// main's own rollback afterwards must not undo anything.
+	if err := os.WriteFile(bin, []byte("edited"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := bk.Restore(); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(bin); string(data) != "edited" {
+		t.Errorf("second restore touched %s: %q", bin, data)
+	}
+}
@@ -0,0 +1,198 @@
+package installer
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/you/mullvad-installer/internal/debpkg"
+	"github.com/you/mullvad-installer/internal/fsmeta"
+	"github.com/you/mullvad-installer/internal/remove"
+	"github.com/you/mullvad-installer/internal/service"
+	"github.com/you/mullvad-installer/internal/ui"
+)
+
+// stageRoot is one top-level package directory and the live directory it
+// installs into. Entries are unpacked into a hidden staging directory next
+// to the target, so committing is a rename on the same filesystem.
+type stageRoot struct {
+	target string
+	dir    string
+	sink   *debpkg.DirSink
+}
+
+// stagingSink maps top-level package directories onto live roots via a
+// PathPolicy and streams their entries into per-root staging areas.
+type stagingSink struct {
+	policy   PathPolicy
+	roots    map[string]*stageRoot
+	ignored  map[string]bool
+	unmapped []string
+}
+
+func newStagingSink(policy PathPolicy) *stagingSink {
+	return &stagingSink{
+		policy:  policy,
+		roots:   map[string]*stageRoot{},
+		ignored: map[string]bool{},
+	}
+}
+
+func (s *stagingSink) Entry(hdr *tar.Header, body io.Reader) error {
+	top, rest, _ := strings.Cut(hdr.Name, "/")
+	if s.ignored[top] {
+		return nil
+	}
+	root, ok := s.roots[top]
+	if !ok {
+		target, skipped, mapped := s.policy.Target(top)
+		if !mapped {
+			s.ignored[top] = true
+			if skipped {
+				ui.Info(fmt.Sprintf("Skipping package directory %s/ by policy", top))
+			} else {
+				s.unmapped = append(s.unmapped, top)
+			}
+			return nil
+		}
+		root = &stageRoot{target: target}
+		s.roots[top] = root
+	}
+	if rest == "" {
+		// The live root itself (/opt, /usr) keeps its own metadata.
+		return nil
+	}
+
+	if root.dir == "" {
+		dir, err := os.MkdirTemp(root.target, ".mullvad-staging-")
+		if err != nil {
+			return fmt.Errorf("create staging dir in %s: %w", root.target, err)
+		}
+		RegisterTmpDir(dir)
+		root.dir = dir
+		root.sink = debpkg.NewDirSink(dir, false)
+	}
+
+	staged := *hdr
+	staged.Name = rest
+	if hdr.Typeflag == tar.TypeLink {
+		linkTop, linkRest, _ := strings.Cut(hdr.Linkname, "/")
+		if linkTop != top {
+			return fmt.Errorf("hard link %s → %s crosses install roots", hdr.Name, hdr.Linkname)
+		}
+		staged.Linkname = linkRest
+	}
+	return root.sink.Entry(&staged, body)
+}
+
+func (s *stagingSink) Done() error {
+	logUnmapped(s.unmapped)
+	return nil
+}
+
+// commit moves every staged entry into its live location. Files and links
+// are renamed over whatever is there, which also works for binaries that
+// are currently running; conffiles under /etc the admin edited are kept,
+// with the new version beside them. Missing directories are created with
+// the package's metadata and existing ones are left as they are. Whatever
+// was installed is recorded for removal.
+func (s *stagingSink) commit() error {
+	var files, dirs []string
+	for _, root := range s.roots {
+		if root.dir == "" {
+			continue
+		}
+		f, d, err := commitTree(root.dir, root.target)
+		files, dirs = append(files, f...), append(dirs, d...)
+		if err != nil {
+			return errors.Join(err, remove.Record(files, dirs))
+		}
+	}
+	s.discard()
+	return remove.Record(files, dirs)
+}
+
+// discard removes whatever is left of the staging areas.
+func (s *stagingSink) discard() {
+	for _, root := range s.roots {
+		if root.dir == "" {
+			continue
+		}
+		_ = os.RemoveAll(root.dir)
+		UnregisterTmpDir(root.dir)
+		root.dir = ""
+	}
+}
+
+// commitTree moves stage into dst and returns the files and the
+// directories it put there.
+func commitTree(stage, dst string) (files, created []string, err error) {
+	type dirMeta struct {
+		path string
+		meta fsmeta.Meta
+	}
+	var dirs []dirMeta
+
+	err = filepath.WalkDir(stage, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == stage {
+			return nil
+		}
+		rel, _ := filepath.Rel(stage, path)
+		target := filepath.Join(dst, rel)
+
+		if d.IsDir() {
+			meta, err := fsmeta.FromPath(path)
+			if err != nil {
+				return err
+			}
+			// Like dpkg, leave directories that already exist alone: /usr/bin
+			// and host symlinks such as /lib → usr/lib belong to the system.
+			if err := os.Mkdir(target, 0o755); os.IsExist(err) {
+				return nil
+			} else if err != nil {
+				return fmt.Errorf("mkdir %s: %w", target, err)
+			}
+			if err := fsmeta.Apply(target, meta); err != nil {
+				return err
+			}
+			dirs = append(dirs, dirMeta{target, meta})
+			created = append(created, target)
+			return nil
+		}
+
+		dst := target
+		if service.IsConffile(target) && d.Type().IsRegular() {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			if dst, err = service.PlaceConffile(target, data); err != nil {
+				return err
+			}
+		}
+		ui.Info("Installing file ", dst)
+		if err := os.Rename(path, dst); err != nil {
+			return fmt.Errorf("install %s: %w", dst, err)
+		}
+		files = append(files, target)
+		return nil
+	})
+	if err != nil {
+		return files, created, err
+	}
+
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := fsmeta.ApplyTimes(dirs[i].path, dirs[i].meta); err != nil {
+			return files, created, err
+		}
+	}
+	return files, created, nil
+}
@@ -0,0 +1,167 @@
+package installer
+
+import (
+	"archive/tar"
+	"crypto/md5"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/you/mullvad-installer/internal/config"
+	"github.com/you/mullvad-installer/internal/debpkg"
+	"github.com/you/mullvad-installer/internal/remove"
+)
+
+// setManifest points the install manifest at a temporary file.
+func setManifest(t *testing.T) {
+	t.Helper()
+	old := remove.ManifestPath
+	t.Cleanup(func() { remove.ManifestPath = old })
+	remove.ManifestPath = filepath.Join(t.TempDir(), "installed-files")
+}
+
+func md5Hex(s string) string {
+	h := md5.Sum([]byte(s))
+	return hex.EncodeToString(h[:])
+}
+
+// stageEntries feeds entries, whose regular files contain their own name,
+// through md5 verification into a staging sink for a policy that maps usr/
+// to a temporary live root. It returns that root and the sink.
+func stageEntries(t *testing.T, entries []*tar.Header) (string, *stagingSink) {
+	t.Helper()
+	setManifest(t)
+	live := t.TempDir()
+	policy := NewPathPolicy(&config.Config{PathMap: map[string]string{"usr": live}})
+	stage := newStagingSink(policy)
+	t.Cleanup(stage.discard)
+
+	sums := map[string]string{}
+	for _, h := range entries {
+		switch h.Typeflag {
+		case tar.TypeReg:
+			sums[h.Name] = md5Hex(h.Name)
+		case tar.TypeLink:
+			sums[h.Name] = md5Hex(h.Linkname)
+		}
+	}
+	sink := debpkg.NewVerifySink(&debpkg.PackageInfo{MD5Sums: sums}, stage)
+	for _, h := range entries {
+		h.Size = 0
+		body := strings.NewReader("")
+		if h.Typeflag == tar.TypeReg {
+			h.Size = int64(len(h.Name))
+			body = strings.NewReader(h.Name)
+		}
+		if err := sink.Entry(h, body); err != nil {
+			t.Fatalf("entry %s: %v", h.Name, err)
+		}
+	}
+	if err := sink.Done(); err != nil {
+		t.Fatal(err)
+	}
+	return live, stage
+}
+
+func TestStageAndCommit(t *testing.T) {
+	live, stage := stageEntries(t, []*tar.Header{
+		{Name: "usr/", Typeflag: tar.TypeDir, Mode: 0o755},
+		{Name: "usr/bin/", Typeflag: tar.TypeDir, Mode: 0o755},
+		{Name: "usr/bin/mullvad", Typeflag: tar.TypeReg, Mode: 0o755},
+		{Name: "usr/bin/mullvad-alias", Typeflag: tar.TypeLink, Linkname: "usr/bin/mullvad", Mode: 0o755},
+		{Name: "usr/bin/mullvad-link", Typeflag: tar.TypeSymlink, Linkname: "mullvad", Mode: 0o777},
+	})
+
+	// Nothing is live before commit.
+	if _, err := os.Lstat(filepath.Join(live, "bin")); !os.IsNotExist(err) {
+		t.Fatalf("bin/ exists before commit: %v", err)
+	}
+	if err := stage.commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(live, "bin/mullvad"))
+	if err != nil || string(data) != "usr/bin/mullvad" {
+		t.Fatalf("bin/mullvad = %q, %v", data, err)
+	}
+	a, err1 := os.Stat(filepath.Join(live, "bin/mullvad"))
+	b, err2 := os.Stat(filepath.Join(live, "bin/mullvad-alias"))
+	if err1 != nil || err2 != nil || !os.SameFile(a, b) {
+		t.Errorf("mullvad-alias is not a hard link to mullvad: %v %v", err1, err2)
+	} else if n := a.Sys().(*syscall.Stat_t).Nlink; n != 2 {
+		t.Errorf("link count = %d, want 2", n)
+	}
+	if target, err := os.Readlink(filepath.Join(live, "bin/mullvad-link")); err != nil || target != "mullvad" {
+		t.Errorf("mullvad-link → %q, %v", target, err)
+	}
+
+	// The staging area is gone after commit.
+	left, _ := filepath.Glob(filepath.Join(live, ".mullvad-staging-*"))
+	if len(left) != 0 {
+		t.Errorf("staging left behind: %v", left)
+	}
+
+	// Everything installed is recorded for removal.
+	files, dirs, err := remove.ReadManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"bin/mullvad", "bin/mullvad-alias", "bin/mullvad-link"}
+	if len(files) != len(want) {
+		t.Fatalf("manifest files = %v, want %v", files, want)
+	}
+	for i, f := range files {
+		if f != filepath.Join(live, want[i]) {
+			t.Errorf("manifest file %d = %s, want %s", i, f, filepath.Join(live, want[i]))
+		}
+	}
+	if len(dirs) != 1 || dirs[0] != filepath.Join(live, "bin") {
+		t.Errorf("manifest dirs = %v, want [%s]", dirs, filepath.Join(live, "bin"))
+	}
+}
+
+func TestCommitLeavesExistingDirs(t *testing.T) {
+	setManifest(t)
+	live := t.TempDir()
+	bin := filepath.Join(live, "bin")
+	if err := os.Mkdir(bin, 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	policy := NewPathPolicy(&config.Config{PathMap: map[string]string{"usr": live}})
+	stage := newStagingSink(policy)
+	t.Cleanup(stage.discard)
+	mtime := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	for _, h := range []*tar.Header{
+		{Name: "usr/bin/", Typeflag: tar.TypeDir, Mode: 0o755, ModTime: mtime},
+		{Name: "usr/bin/mullvad", Typeflag: tar.TypeReg, Mode: 0o755, ModTime: mtime},
+		{Name: "usr/share/", Typeflag: tar.TypeDir, Mode: 0o750, ModTime: mtime},
+	} {
+		if err := stage.Entry(h, strings.NewReader("")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := stage.commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	fi, err := os.Stat(bin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0o700 {
+		t.Errorf("existing bin/ mode = %v, want 0700", fi.Mode().Perm())
+	}
+
+	fi, err = os.Stat(filepath.Join(live, "share"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0o750 || fi.ModTime().Unix() != mtime.Unix() {
+		t.Errorf("new share/ = %v %v, want 0750 %v", fi.Mode().Perm(), fi.ModTime(), mtime)
+	}
+}
@@ -17,6 +17,7 @@ func init() {
 	signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
 	go func() {
 		<-c
+		restorePending()
 		CleanupAll()
 		os.Exit(1)
 	}()
@@ -0,0 +1,122 @@
+package remove
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ManifestPath lists everything installs have put on the system from the
+// package, one path per line, directories with a trailing slash. It covers
+// what Paths cannot know about, such as new upstream files under /usr/lib
+// or /etc.
+var ManifestPath = "/var/lib/mullvad-installer/installed-files"
+
+// ReadManifest returns the recorded files and directories. A missing
+// manifest is an install from before there was one.
+func ReadManifest() (files, dirs []string, err error) {
+	f, err := os.Open(ManifestPath)
+	if os.IsNotExist(err) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("read install manifest: %w", err)
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := sc.Text()
+		switch {
+		case line == "":
+		case strings.HasSuffix(line, "/"):
+			dirs = append(dirs, strings.TrimSuffix(line, "/"))
+		default:
+			files = append(files, line)
+		}
+	}
+	return files, dirs, sc.Err()
+}
+
+// Record adds files and the directories an install created to the
+// manifest.
+func Record(files, dirs []string) error {
+	oldFiles, oldDirs, err := ReadManifest()
+	if err != nil {
+		return err
+	}
+	return writeManifest(append(oldFiles, files...), append(oldDirs, dirs...))
+}
+
+// pruneManifest drops the entries a removal took away, deleting the
+// manifest once nothing is left.
+func pruneManifest() error {
+	files, dirs, err := ReadManifest()
+	if err != nil {
+		return err
+	}
+	exists := func(paths []string) []string {
+		var kept []string
+		for _, p := range paths {
+			if _, err := os.Lstat(p); err == nil {
+				kept = append(kept, p)
+			}
+		}
+		return kept
+	}
+	files, dirs = exists(files), exists(dirs)
+	if len(files) == 0 && len(dirs) == 0 {
+		if err := os.Remove(ManifestPath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	return writeManifest(files, dirs)
+}
+
+func writeManifest(files, dirs []string) error {
+	lines := map[string]bool{}
+	for _, p := range files {
+		lines[p] = true
+	}
+	for _, d := range dirs {
+		lines[d+"/"] = true
+	}
+	sorted := make([]string, 0, len(lines))
+	for l := range lines {
+		sorted = append(sorted, l)
+	}
+	sort.Strings(sorted)
+
+	if err := os.MkdirAll(filepath.Dir(ManifestPath), 0o755); err != nil {
+		return err
+	}
+	data := strings.Join(sorted, "\n") + "\n"
+	if err := os.WriteFile(ManifestPath, []byte(data), 0o644); err != nil {
+		return fmt.Errorf("record installed files: %w", err)
+	}
+	return nil
+}
+
+// Installed returns Paths followed by the recorded files, the order in
+// which they are set aside or removed.
+func Installed() ([]string, error) {
+	files, _, err := ReadManifest()
+	if err != nil {
+		return nil, err
+	}
+	paths := append([]string{}, Paths...)
+	seen := map[string]bool{}
+	for _, p := range paths {
+		seen[p] = true
+	}
+	for _, p := range files {
+		if !seen[p] {
+			seen[p] = true
+			paths = append(paths, p)
+		}
+	}
+	return paths, nil
+}
@@ -0,0 +1,41 @@
+package remove
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestManifest(t *testing.T) {
+	old := ManifestPath
+	t.Cleanup(func() { ManifestPath = old })
+	ManifestPath = filepath.Join(t.TempDir(), "sub", "installed-files")
+
+	if files, dirs, err := ReadManifest(); err != nil || files != nil || dirs != nil {
+		t.Fatalf("missing manifest = %v %v %v, want empty", files, dirs, err)
+	}
+	if err := Record([]string{"/usr/lib/mullvad/a", "/etc/mullvad/b"}, []string{"/usr/lib/mullvad"}); err != nil {
+		t.Fatal(err)
+	}
+	// A later install adds to what is there.
+	if err := Record([]string{"/usr/lib/mullvad/a", "/usr/lib/mullvad/c"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	files, dirs, err := ReadManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 3 || files[0] != "/etc/mullvad/b" || files[2] != "/usr/lib/mullvad/c" {
+		t.Errorf("files = %v", files)
+	}
+	if len(dirs) != 1 || dirs[0] != "/usr/lib/mullvad" {
+		t.Errorf("dirs = %v", dirs)
+	}
+
+	paths, err := Installed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != len(Paths)+3 || paths[0] != Paths[0] || paths[len(Paths)] != "/etc/mullvad/b" {
+		t.Errorf("Installed = %v", paths)
+	}
+}
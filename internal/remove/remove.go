@@ -3,90 +3,75 @@ package remove
 import (
 	"fmt"
 	"os"
-	"os/exec"
+	"sort"
 
 	"github.com/you/mullvad-installer/internal/config"
 	initpkg "github.com/you/mullvad-installer/internal/init"
+	"github.com/you/mullvad-installer/internal/service"
 	"github.com/you/mullvad-installer/internal/ui"
 )
 
-func Remove(cfg *config.Config) error {
-	initSys := initpkg.Detect()
-	svcName := "mullvad-daemon"
+// Paths are what an installation puts on the system besides its service
+// files.
+var Paths = []string{
+	"/usr/share/bash-completion/completions/mullvad",
+	"/usr/share/icons/hicolor/32x32/apps/mullvad-vpn.png",
+	"/usr/share/icons/hicolor/48x48/apps/mullvad-vpn.png",
+	"/usr/share/icons/hicolor/64x64/apps/mullvad-vpn.png",
+	"/usr/share/icons/hicolor/128x128/apps/mullvad-vpn.png",
+	"/usr/share/icons/hicolor/256x256/apps/mullvad-vpn.png",
+	"/usr/share/icons/hicolor/512x512/apps/mullvad-vpn.png",
+	"/usr/share/icons/hicolor/1024x1024/apps/mullvad-vpn.png",
+	"/usr/share/fish/vendor_completions.d/mullvad.fish",
+	"/usr/share/doc/mullvad-vpn",
+	"/usr/share/applications/mullvad-vpn.desktop",
+	"/usr/local/share/zsh/site-functions/_mullvad",
+	"/usr/bin/mullvad",
+	"/usr/bin/mullvad-daemon",
+	"/usr/bin/mullvad-exclude",
+	"/usr/bin/mullvad-problem-report",
+	"/opt/Mullvad VPN",
+}
 
-	switch initSys {
-	case initpkg.Systemd:
-		ui.Info("Detected systemd → stopping and disabling Mullvad service")
-		if !cfg.DryRun {
-			_ = runCmd("systemctl", "stop", svcName+".service")
-			_ = runCmd("systemctl", "disable", svcName+".service")
-			_ = os.Remove("/etc/systemd/system/" + svcName + ".service")
-			_ = runCmd("systemctl", "daemon-reload")
-		}
+// isConffile is service.IsConffile, replaceable so tests need not use /etc.
+var isConffile = service.IsConffile
 
-	case initpkg.Runit:
-		ui.Info("Detected runit → stopping Mullvad service")
-		if !cfg.DryRun {
-			_ = runCmd("sv", "stop", svcName)
-			_ = os.Remove("/var/service/" + svcName)
-			_ = os.RemoveAll("/etc/sv/" + svcName)
-		}
+// Mode says what a removal is for.
+type Mode int
 
-	case initpkg.SysV:
-		ui.Info("Detected SysV init → stopping and removing init.d script")
-		if !cfg.DryRun {
-			_ = runCmd("/etc/init.d/"+svcName, "stop")
-			_ = os.Remove("/etc/init.d/" + svcName)
-		}
-
-	case initpkg.OpenRC:
-		ui.Info("Detected OpenRC → stopping and removing service")
-		if !cfg.DryRun {
-			_ = runCmd("rc-service", svcName, "stop")
-			_ = runCmd("rc-update", "del", svcName, "default")
-			_ = os.Remove("/etc/init.d/" + svcName)
-		}
+const (
+	// Upgrade makes way for a new install. Like dpkg, it keeps conffiles,
+	// so the new install can tell whether they were edited.
+	Upgrade Mode = iota
+	// Uninstall removes everything.
+	Uninstall
+)
 
-	case initpkg.S6:
-		ui.Info("Detected s6 → removing service directory")
-		if !cfg.DryRun {
-			_ = os.RemoveAll("/etc/s6/" + svcName)
-			_ = os.Remove("/var/service/" + svcName)
+func Remove(cfg *config.Config, initSys initpkg.InitSystem, mode Mode) error {
+	if b, err := service.Lookup(initSys, service.ParamsFromConfig(cfg)); err != nil {
+		ui.Info("Unknown init system → skipping service stop/removal")
+	} else {
+		if mode == Upgrade {
+			ui.Info(fmt.Sprintf("Detected %s → stopping and disabling Mullvad services", initSys))
+		} else {
+			ui.Info(fmt.Sprintf("Detected %s → stopping, disabling and removing Mullvad services", initSys))
 		}
-
-	case initpkg.Dinit:
-		ui.Info("Detected dinit → stopping and removing service")
 		if !cfg.DryRun {
-			_ = runCmd("dinitctl", "stop", svcName)
-			_ = os.Remove("/etc/dinit.d/" + svcName)
-			_ = runCmd("dinitctl", "reload")
+			service.Teardown(b, mode == Upgrade)
 		}
-
-	default:
-		ui.Info("Unknown init system → skipping service stop/removal")
 	}
 
-	additionalPaths := []string{
-		"/usr/share/bash-completion/completions/mullvad",
-		"/usr/share/icons/hicolor/32x32/apps/mullvad-vpn.png",
-		"/usr/share/icons/hicolor/48x48/apps/mullvad-vpn.png",
-		"/usr/share/icons/hicolor/64x64/apps/mullvad-vpn.png",
-		"/usr/share/icons/hicolor/128x128/apps/mullvad-vpn.png",
-		"/usr/share/icons/hicolor/256x256/apps/mullvad-vpn.png",
-		"/usr/share/icons/hicolor/512x512/apps/mullvad-vpn.png",
-		"/usr/share/icons/hicolor/1024x1024/apps/mullvad-vpn.png",
-		"/usr/share/fish/vendor_completions.d/mullvad.fish",
-		"/usr/share/doc/mullvad-vpn",
-		"/usr/share/applications/mullvad-vpn.desktop",
-		"/usr/local/share/zsh/site-functions/_mullvad",
-		"/usr/bin/mullvad",
-		"/usr/bin/mullvad-daemon",
-		"/usr/bin/mullvad-exclude",
-		"/usr/bin/mullvad-problem-report",
-		"/opt/Mullvad VPN",
+	paths, err := Installed()
+	if err != nil {
+		return err
 	}
-
-	for _, path := range additionalPaths {
+	for _, path := range paths {
+		if mode == Upgrade && isConffile(path) {
+			continue
+		}
+		if _, err := os.Lstat(path); os.IsNotExist(err) {
+			continue
+		}
 		ui.Info("Removing ", path)
 		if cfg.DryRun {
 			ui.Info("  (dry-run) skipping")
@@ -97,13 +82,27 @@ func Remove(cfg *config.Config) error {
 		}
 	}
 
+	if !cfg.DryRun {
+		removeEmptyDirs()
+		if err := pruneManifest(); err != nil {
+			return err
+		}
+	}
+
 	ui.Info("Uninstallation complete.")
 	return nil
 }
 
-func runCmd(name string, args ...string) error {
-	cmd := exec.Command(name, args...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	return cmd.Run()
+// removeEmptyDirs deletes the directories installs created, deepest first,
+// where nothing else has been put in them since.
+func removeEmptyDirs() {
+	_, dirs, err := ReadManifest()
+	if err != nil {
+		ui.Warn(err.Error())
+		return
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(dirs)))
+	for _, d := range dirs {
+		_ = os.Remove(d)
+	}
 }
@@ -0,0 +1,72 @@
+package remove
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/you/mullvad-installer/internal/config"
+)
+
+func TestRemoveModes(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		mode     Mode
+		keepConf bool
+	}{
+		{"upgrade", Upgrade, true},
+		{"uninstall", Uninstall, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			oldPaths, oldManifest, oldConf := Paths, ManifestPath, isConffile
+			t.Cleanup(func() { Paths, ManifestPath, isConffile = oldPaths, oldManifest, oldConf })
+			etc := filepath.Join(root, "etc")
+			isConffile = func(p string) bool { return strings.HasPrefix(p, etc+"/") }
+			ManifestPath = filepath.Join(root, "installed-files")
+			app := filepath.Join(root, "opt", "app")
+			Paths = []string{app}
+
+			conf := filepath.Join(etc, "mullvad", "settings.conf")
+			lib := filepath.Join(root, "usr", "lib", "mullvad", "lib.so")
+			for _, p := range []string{filepath.Join(app, "bin"), conf, lib} {
+				if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(p, []byte("x"), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := Record([]string{conf, lib}, []string{filepath.Dir(conf), filepath.Dir(lib)}); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := Remove(&config.Config{}, "none", tt.mode); err != nil {
+				t.Fatal(err)
+			}
+			for _, p := range []string{app, lib, filepath.Dir(lib)} {
+				if _, err := os.Lstat(p); !os.IsNotExist(err) {
+					t.Errorf("%s still there: %v", p, err)
+				}
+			}
+			_, err := os.Stat(conf)
+			if kept := err == nil; kept != tt.keepConf {
+				t.Errorf("conffile kept = %v, want %v", kept, tt.keepConf)
+			}
+
+			// The manifest only lists what is left, and is gone when nothing is.
+			files, dirs, err := ReadManifest()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.keepConf {
+				if len(files) != 1 || files[0] != conf || len(dirs) != 1 || dirs[0] != filepath.Dir(conf) {
+					t.Errorf("manifest = %v %v, want only %s", files, dirs, conf)
+				}
+			} else if _, err := os.Stat(ManifestPath); !os.IsNotExist(err) {
+				t.Errorf("manifest left after uninstall: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,451 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	initpkg "github.com/you/mullvad-installer/internal/init"
+	"github.com/you/mullvad-installer/internal/ui"
+)
+
+var ErrUnsupported = errors.New("unsupported init system")
+
+// Backend manages mullvad-daemon, and the early-boot blocking service that
+// goes with it, under one init system. Each init system lives in its own
+// file and registers itself from init().
+type Backend interface {
+	Name() initpkg.InitSystem
+	// Render returns every file Install writes, without touching the system.
+	Render() ([]File, error)
+	Install() error
+	// Enable arranges for the services to come up on boot.
+	Enable() error
+	Start() error
+	Stop() error
+	// Status reports whether the daemon is running. err is only set when
+	// the init system could not be asked.
+	Status() (running bool, err error)
+	Disable() error
+	// Remove deletes what Install wrote.
+	Remove() error
+}
+
+// File is one service file as it will be written to disk.
+type File struct {
+	Path   string
+	Mode   os.FileMode
+	Data   []byte
+	Source string // the template Data was rendered from, if any
+}
+
+var registry = map[initpkg.InitSystem]func(Params) Backend{}
+
+func register(sys initpkg.InitSystem, newBackend func(Params) Backend) {
+	registry[sys] = newBackend
+}
+
+// Lookup returns the backend for sys, rendering its templates with p.
+func Lookup(sys initpkg.InitSystem, p Params) (Backend, error) {
+	newBackend, ok := registry[sys]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupported, sys)
+	}
+	p.init = sys
+	return newBackend(p), nil
+}
+
+func Supported(sys initpkg.InitSystem) bool {
+	_, ok := registry[sys]
+	return ok
+}
+
+// Names lists the registered init systems, sorted.
+func Names() []initpkg.InitSystem {
+	names := make([]initpkg.InitSystem, 0, len(registry))
+	for n := range registry {
+		names = append(names, n)
+	}
+	sort.Slice(names, func(i, j int) bool { return names[i] < names[j] })
+	return names
+}
+
+// Setup installs, enables and starts the daemon under b.
+func Setup(b Backend) error {
+	if err := b.Install(); err != nil {
+		return fmt.Errorf("install: %w", err)
+	}
+	if err := b.Enable(); err != nil {
+		return fmt.Errorf("enable: %w", err)
+	}
+	if err := b.Start(); err != nil {
+		return fmt.Errorf("start: %w", err)
+	}
+	return nil
+}
+
+// Teardown stops, disables and removes the daemon under b. With keepFiles,
+// as before an upgrade, the service files stay, so the new install can
+// tell which of them were edited. It carries on past failures, since a
+// half-removed service is still worth cleaning up.
+func Teardown(b Backend, keepFiles bool) {
+	steps := []struct {
+		name string
+		fn   func() error
+	}{
+		{"stop", b.Stop},
+		{"disable", b.Disable},
+		{"remove", b.Remove},
+	}
+	if keepFiles {
+		steps = steps[:2]
+	}
+	for _, s := range steps {
+		if err := s.fn(); err != nil {
+			ui.Warn(fmt.Sprintf("%s %s service: %v", s.name, b.Name(), err))
+		}
+	}
+}
+
+// templateFile renders the template tpl, or the admin's override of it,
+// as dst.
+func (p Params) templateFile(dst, tpl string, mode os.FileMode) (File, error) {
+	text, source, err := p.loadTemplate(tpl)
+	if err != nil {
+		return File{}, err
+	}
+	data, err := p.render(source, text)
+	if err != nil {
+		return File{}, err
+	}
+	return File{Path: dst, Mode: mode, Data: data, Source: source}, nil
+}
+
+// templateTree renders every template under base into dir, keeping the
+// relative layout. rename maps template names that differ on disk.
+func (p Params) templateTree(base, dir string, rename map[string]string) ([]File, error) {
+	var files []File
+	err := fs.WalkDir(templates, base, func(tpl string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, _ := filepath.Rel(base, tpl)
+		if to, ok := rename[rel]; ok {
+			rel = to
+		}
+		f, err := p.templateFile(filepath.Join(dir, rel), tpl, 0o755)
+		files = append(files, f)
+		return err
+	})
+	return files, err
+}
+
+// writeFiles writes files, keeping local edits to conffiles.
+func writeFiles(files []File) error {
+	ledger, err := readLedger()
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		dst := f.Path
+		if IsConffile(f.Path) {
+			if dst, err = resolveConffile(f, ledger); err != nil {
+				return err
+			}
+			ledger[f.Path] = hashData(f.Data)
+		}
+		if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(dst, f.Data, f.Mode); err != nil {
+			return fmt.Errorf("write %s: %w", dst, err)
+		}
+	}
+	return writeLedger(ledger)
+}
+
+// installFiles writes files and creates the log directory the daemon's
+// output goes to, which no init system creates by itself.
+func (p Params) installFiles(files []File) error {
+	if err := os.MkdirAll(p.LogDir, 0o755); err != nil {
+		return err
+	}
+	return writeFiles(files)
+}
+
+// removeFiles deletes files along with any .new copies writeFiles left
+// beside them, and forgets their hashes.
+func removeFiles(files []File) error {
+	ledger, err := readLedger()
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, f := range files {
+		for _, p := range []string{f.Path, f.Path + ".new"} {
+			if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+				errs = append(errs, err)
+			}
+		}
+		delete(ledger, f.Path)
+	}
+	return errors.Join(append(errs, writeLedger(ledger))...)
+}
+
+// remover is implemented by backends whose Remove deletes files Render
+// does not list, such as those an earlier layout used.
+type remover interface{ removed() []File }
+
+// reloader is implemented by backends whose init system has to be told
+// that service files changed before it will act on them.
+type reloader interface{ reload() error }
+
+// removeServiceDirs deletes files with removeFiles, then every directory
+// from each root down that held them, deepest first, where nothing but a
+// supervisor's supervise/ state is left. Anything the admin added stays.
+func removeServiceDirs(files []File, roots ...string) error {
+	if err := removeFiles(files); err != nil {
+		return err
+	}
+	seen := map[string]bool{}
+	var dirs []string
+	for _, f := range files {
+		for _, root := range roots {
+			if !strings.HasPrefix(f.Path, root+"/") {
+				continue
+			}
+			for d := filepath.Dir(f.Path); len(d) >= len(root) && !seen[d]; d = filepath.Dir(d) {
+				seen[d] = true
+				dirs = append(dirs, d)
+			}
+		}
+	}
+	sort.Slice(dirs, func(i, j int) bool { return len(dirs[i]) > len(dirs[j]) })
+	for _, d := range dirs {
+		_ = os.RemoveAll(filepath.Join(d, "supervise"))
+		_ = os.Remove(d)
+	}
+	return nil
+}
+
+// Snapshot saves every service file b writes or removes as it is now. The
+// returned restore puts them back, for rolling back a failed upgrade;
+// Reload then makes the init system see them again.
+func Snapshot(b Backend) (restore func() error, err error) {
+	files, err := b.Render()
+	if err != nil {
+		return nil, fmt.Errorf("render %s service: %w", b.Name(), err)
+	}
+	if r, ok := b.(remover); ok {
+		files = append(files, r.removed()...)
+	}
+	return snapshotFiles(files)
+}
+
+// Reload tells the init system under b to reread service files changed
+// behind its back.
+func Reload(b Backend) error {
+	if r, ok := b.(reloader); ok {
+		return r.reload()
+	}
+	return nil
+}
+
+// snapshotFiles saves what is on disk where files, the .new copies beside
+// them and the hash ledger would go. The returned restore puts it all
+// back, deleting whatever did not exist before.
+func snapshotFiles(files []File) (restore func() error, err error) {
+	type saved struct {
+		data []byte
+		mode os.FileMode
+		ok   bool
+	}
+	paths := []string{ledgerPath}
+	for _, f := range files {
+		paths = append(paths, f.Path, f.Path+".new")
+	}
+	before := map[string]saved{}
+	for _, p := range paths {
+		fi, err := os.Stat(p)
+		if os.IsNotExist(err) {
+			before[p] = saved{}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return nil, fmt.Errorf("back up %s: %w", p, err)
+		}
+		before[p] = saved{data, fi.Mode().Perm(), true}
+	}
+	return func() error {
+		var errs []error
+		for p, s := range before {
+			var err error
+			if s.ok {
+				// Remove may have taken the directory along, as with the
+				// systemd drop-in.
+				err = os.MkdirAll(filepath.Dir(p), 0o755)
+				if err == nil {
+					err = os.WriteFile(p, s.data, s.mode)
+				}
+				if err == nil {
+					err = os.Chmod(p, s.mode)
+				}
+			} else if err = os.Remove(p); os.IsNotExist(err) {
+				err = nil
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("restore %s: %w", p, err))
+			}
+		}
+		return errors.Join(errs...)
+	}, nil
+}
+
+// relink points link at target, replacing whatever link was there.
+func relink(target, link string) error {
+	if err := os.MkdirAll(path.Dir(link), 0o755); err != nil {
+		return err
+	}
+	_ = os.Remove(link)
+	return os.Symlink(target, link)
+}
+
+// blockMarkers delimit the lines we own inside a file shared with the
+// distribution or the admin, in that file's comment syntax.
+type blockMarkers struct{ begin, end string }
+
+var (
+	shellBlock  = blockMarkers{"# BEGIN mullvad-installer\n", "# END mullvad-installer\n"}
+	schemeBlock = blockMarkers{";; BEGIN mullvad-installer\n", ";; END mullvad-installer\n"}
+)
+
+// add appends body to the file at path between the markers, replacing an
+// earlier block. A missing file is created starting with header.
+func (m blockMarkers) add(path, body, header string) error {
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if len(data) == 0 {
+		data = []byte(header)
+	}
+	data = m.cut(data)
+	if len(data) > 0 && !bytes.HasSuffix(data, []byte("\n")) {
+		data = append(data, '\n')
+	}
+	data = append(data, m.begin+body+m.end...)
+	mode := os.FileMode(0o755)
+	if fi, err := os.Stat(path); err == nil {
+		mode = fi.Mode().Perm()
+	}
+	return os.WriteFile(path, data, mode)
+}
+
+func (m blockMarkers) remove(path string) error {
+	fi, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, m.cut(data), fi.Mode().Perm())
+}
+
+func (m blockMarkers) cut(data []byte) []byte {
+	begin := bytes.Index(data, []byte(m.begin))
+	if begin < 0 {
+		return data
+	}
+	end := bytes.Index(data[begin:], []byte(m.end))
+	if end < 0 {
+		return data
+	}
+	return append(data[:begin:begin], data[begin+end+len(m.end):]...)
+}
+
+// runAll runs each argv in turn and stops at the first failure.
+func runAll(cmds ...[]string) error {
+	for _, argv := range cmds {
+		cmd := quietCmd(argv)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("cmd %q: %w", strings.Join(argv, " "), err)
+		}
+	}
+	return nil
+}
+
+// probe runs argv quietly and reports whether it exited 0. Failing to run
+// it at all is an error.
+func probe(argv ...string) (bool, error) {
+	err := quietCmd(argv).Run()
+	var exit *exec.ExitError
+	if errors.As(err, &exit) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// supervisedTimeout covers a few of runsvdir's five-second rescans.
+const supervisedTimeout = 15 * time.Second
+
+// waitSupervised waits until a runsv or s6-supervise process has taken
+// over the service directory dir, which both signal by creating
+// supervise/ok.
+func waitSupervised(dir string, timeout time.Duration) error {
+	ok := filepath.Join(dir, "supervise", "ok")
+	deadline := time.Now().Add(timeout)
+	for {
+		if _, err := os.Stat(ok); err == nil {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%s: no supervisor after %s (%s missing)", dir, timeout, ok)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// findProcess returns the pid and arguments of the first running process
+// whose executable is called name.
+func findProcess(name string) (pid string, args []string) {
+	procs, _ := os.ReadDir("/proc")
+	for _, p := range procs {
+		if _, err := strconv.Atoi(p.Name()); err != nil {
+			continue
+		}
+		cmdline, err := os.ReadFile(filepath.Join("/proc", p.Name(), "cmdline"))
+		if err != nil || len(cmdline) == 0 {
+			continue
+		}
+		argv := strings.Split(string(bytes.TrimRight(cmdline, "\x00")), "\x00")
+		if filepath.Base(argv[0]) == name {
+			return p.Name(), argv[1:]
+		}
+	}
+	return "", nil
+}
+
+func haveCmd(name string) bool {
+	_, err := exec.LookPath(name)
+	return err == nil
+}
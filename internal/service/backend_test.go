@@ -0,0 +1,130 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCommandArgsKeepSpaces(t *testing.T) {
+	ok, err := probe("sh", "-c", `test "$1" = "/opt/Mullvad VPN/resources"`, "sh", "/opt/Mullvad VPN/resources")
+	if err != nil || !ok {
+		t.Errorf("argument with a space was split: ok=%v err=%v", ok, err)
+	}
+	if err := run("sh", "-c", `test $# -eq 1`, "sh", "a b"); err != nil {
+		t.Errorf("run split an argument: %v", err)
+	}
+}
+
+func TestWaitSupervised(t *testing.T) {
+	dir := t.TempDir()
+	if err := waitSupervised(dir, 200*time.Millisecond); err == nil {
+		t.Fatal("waitSupervised succeeded without supervise/ok")
+	}
+	go func() {
+		time.Sleep(150 * time.Millisecond)
+		_ = os.MkdirAll(filepath.Join(dir, "supervise"), 0o755)
+		_ = os.WriteFile(filepath.Join(dir, "supervise", "ok"), nil, 0o600)
+	}()
+	if err := waitSupervised(dir, 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// removingBackend renders one file but removes another as well, in a
+// directory of its own, like the systemd drop-in.
+type removingBackend struct {
+	fakeBackend
+	rendered, extra string
+}
+
+func (b removingBackend) Render() ([]File, error) { return []File{{Path: b.rendered}}, nil }
+func (b removingBackend) removed() []File         { return []File{{Path: b.rendered}, {Path: b.extra}} }
+
+func TestSnapshotCoversRemovedFiles(t *testing.T) {
+	old := ledgerPath
+	t.Cleanup(func() { ledgerPath = old })
+	dir := t.TempDir()
+	ledgerPath = filepath.Join(dir, "sums")
+	b := removingBackend{rendered: filepath.Join(dir, "unit"), extra: filepath.Join(dir, "unit.d", "override.conf")}
+	for _, p := range []string{b.rendered, b.extra} {
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(p), 0o640); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	restore, err := Snapshot(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.RemoveAll(filepath.Dir(b.extra)); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(b.rendered); err != nil {
+		t.Fatal(err)
+	}
+	if err := restore(); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{b.rendered, b.extra} {
+		fi, err := os.Stat(p)
+		if err != nil {
+			t.Errorf("%s not restored: %v", p, err)
+		} else if fi.Mode().Perm() != 0o640 {
+			t.Errorf("%s mode = %v, want 0640", p, fi.Mode().Perm())
+		}
+	}
+}
+
+func TestRemoveServiceDirs(t *testing.T) {
+	old := ledgerPath
+	t.Cleanup(func() { ledgerPath = old })
+	root := t.TempDir()
+	ledgerPath = filepath.Join(root, "sums")
+	svc := filepath.Join(root, "sv", "mullvad-daemon")
+	files := []File{{Path: filepath.Join(svc, "run")}, {Path: filepath.Join(svc, "log", "run")}}
+
+	ledger := map[string]string{}
+	for _, p := range []string{files[0].Path, files[1].Path, files[0].Path + ".new", filepath.Join(svc, "supervise", "ok")} {
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		ledger[p] = "ab"
+	}
+	if err := writeLedger(ledger); err != nil {
+		t.Fatal(err)
+	}
+	// Something the admin put next to the log script.
+	keep := filepath.Join(svc, "log", "config")
+	if err := os.WriteFile(keep, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := removeServiceDirs(files, svc); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{files[0].Path, files[0].Path + ".new", files[1].Path, filepath.Join(svc, "supervise")} {
+		if _, err := os.Lstat(p); !os.IsNotExist(err) {
+			t.Errorf("%s still there: %v", p, err)
+		}
+	}
+	if _, err := os.Stat(keep); err != nil {
+		t.Errorf("admin's file removed: %v", err)
+	}
+	got, err := readLedger()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		if _, ok := got[f.Path]; ok {
+			t.Errorf("ledger still lists %s", f.Path)
+		}
+	}
+}
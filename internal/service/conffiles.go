@@ -0,0 +1,130 @@
+package service
+
+import (
+	"bufio"
+	"crypto/sha256"
+	_ "embed"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/you/mullvad-installer/internal/ui"
+)
+
+// ledgerPath records the sha256 of every service file we last wrote under
+// /etc, one "hash  path" line each, like an md5sums file.
+var ledgerPath = "/var/lib/mullvad-installer/service-files.sha256sums"
+
+//go:embed shipped.sha256sums
+var shippedSums string
+
+// shipped maps each path in shippedSums to the hashes recorded for it.
+// Installs from before the ledger existed have no record, so a file
+// matching what the first release wrote there is the only evidence that it
+// is safe to replace.
+var shipped = func() map[string]map[string]bool {
+	m := map[string]map[string]bool{}
+	for _, line := range strings.Split(shippedSums, "\n") {
+		hash, path, ok := strings.Cut(line, "  ")
+		if !ok || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if m[path] == nil {
+			m[path] = map[string]bool{}
+		}
+		m[path][hash] = true
+	}
+	return m
+}()
+
+// IsConffile reports whether path is the admin's to edit. As with dpkg,
+// that is everything under /etc; copies of the package's own units under
+// /usr are replaced outright.
+func IsConffile(path string) bool {
+	return strings.HasPrefix(path, conffileRoot+"/")
+}
+
+// conffileRoot is /etc, moved elsewhere by tests.
+var conffileRoot = "/etc"
+
+func hashData(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func readLedger() (map[string]string, error) {
+	ledger := map[string]string{}
+	f, err := os.Open(ledgerPath)
+	if os.IsNotExist(err) {
+		return ledger, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read service file hashes: %w", err)
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		hash, path, ok := strings.Cut(sc.Text(), "  ")
+		if ok {
+			ledger[path] = hash
+		}
+	}
+	return ledger, sc.Err()
+}
+
+func writeLedger(ledger map[string]string) error {
+	paths := make([]string, 0, len(ledger))
+	for p := range ledger {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	var b strings.Builder
+	for _, p := range paths {
+		fmt.Fprintf(&b, "%s  %s\n", ledger[p], p)
+	}
+	if err := os.MkdirAll(filepath.Dir(ledgerPath), 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(ledgerPath, []byte(b.String()), 0o644); err != nil {
+		return fmt.Errorf("record service file hashes: %w", err)
+	}
+	return nil
+}
+
+// resolveConffile decides where f goes. A file that is missing, identical,
+// unchanged since we last wrote it, or exactly as the first release wrote
+// it is replaced. One edited locally is kept and f goes next to it as .new.
+func resolveConffile(f File, ledger map[string]string) (string, error) {
+	onDisk, err := os.ReadFile(f.Path)
+	if os.IsNotExist(err) {
+		return f.Path, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("read %s: %w", f.Path, err)
+	}
+	have := hashData(onDisk)
+	if have == hashData(f.Data) || have == ledger[f.Path] || shipped[f.Path][have] {
+		return f.Path, nil
+	}
+	ui.Warn(fmt.Sprintf("%s has local changes; keeping it and writing the new version to %s.new", f.Path, f.Path))
+	return f.Path + ".new", nil
+}
+
+// PlaceConffile returns where data, the package's new version of the
+// conffile path, should go, and records it, so files the package ships
+// under /etc get the same treatment as service files.
+func PlaceConffile(path string, data []byte) (string, error) {
+	ledger, err := readLedger()
+	if err != nil {
+		return "", err
+	}
+	dst, err := resolveConffile(File{Path: path, Data: data}, ledger)
+	if err != nil {
+		return "", err
+	}
+	ledger[path] = hashData(data)
+	return dst, writeLedger(ledger)
+}
@@ -0,0 +1,155 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	initpkg "github.com/you/mullvad-installer/internal/init"
+)
+
+// firstLogRun is the runit log script the first release wrote to
+// /etc/sv/mullvad-daemon/log/run, before there was a ledger.
+const firstLogRun = "#!/usr/bin/env sh\n# timestamp + message\nexec svlogd -tt /var/log/mullvad-daemon"
+
+func TestResolveConffile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "mullvad-daemon")
+	f := File{Path: path, Data: []byte("new\n")}
+	old := shipped
+	t.Cleanup(func() { shipped = old })
+	shipped = map[string]map[string]bool{path: {hashData([]byte(firstLogRun)): true}}
+
+	tests := []struct {
+		name   string
+		onDisk string // "" means no file
+		ledger string // recorded content, "" means no record
+		want   string
+	}{
+		{"missing", "", "", path},
+		{"identical", "new\n", "", path},
+		{"unchanged since written", "old\n", "old\n", path},
+		{"edited", "edited\n", "old\n", path + ".new"},
+		{"unknown", "old\n", "", path + ".new"},
+		{"shipped by the first release", firstLogRun, "", path},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Remove(path)
+			if tt.onDisk != "" {
+				if err := os.WriteFile(path, []byte(tt.onDisk), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			ledger := map[string]string{}
+			if tt.ledger != "" {
+				ledger[path] = hashData([]byte(tt.ledger))
+			}
+			got, err := resolveConffile(f, ledger)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("resolveConffile = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLedgerRoundTrip(t *testing.T) {
+	old := ledgerPath
+	t.Cleanup(func() { ledgerPath = old })
+	ledgerPath = filepath.Join(t.TempDir(), "sub", "sums")
+	want := map[string]string{"/etc/sv/mullvad-daemon/run": "ab", "/etc/init.d/mullvad-daemon": "cd"}
+	if err := writeLedger(want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := readLedger()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(want) || got["/etc/sv/mullvad-daemon/run"] != "ab" || got["/etc/init.d/mullvad-daemon"] != "cd" {
+		t.Errorf("readLedger = %v, want %v", got, want)
+	}
+}
+
+func TestShippedKeyedByPath(t *testing.T) {
+	if !shipped["/etc/sv/mullvad-daemon/log/run"][hashData([]byte(firstLogRun))] {
+		t.Fatal("first release's runit log script missing from shipped.sha256sums")
+	}
+	// The same content anywhere else proves nothing about local edits.
+	path := filepath.Join(t.TempDir(), "run")
+	if err := os.WriteFile(path, []byte(firstLogRun), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	got, err := resolveConffile(File{Path: path, Data: []byte("new\n")}, map[string]string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != path+".new" {
+		t.Errorf("resolveConffile = %q, want %q", got, path+".new")
+	}
+}
+
+// TestUpgradeKeepsEditedServiceFile runs what an upgrade does to the runit
+// service, teardown for removal and then install, with a run script the
+// admin edited in between.
+func TestUpgradeKeepsEditedServiceFile(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		keepFiles bool
+	}{
+		{"upgrade", true},
+		{"uninstall then install", false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			oldLedger, oldRoot, oldLayouts := ledgerPath, conffileRoot, runitLayouts
+			t.Cleanup(func() { ledgerPath, conffileRoot, runitLayouts = oldLedger, oldRoot, oldLayouts })
+			ledgerPath = filepath.Join(root, "sums")
+			conffileRoot = filepath.Join(root, "etc")
+			setOverrideDir(t, filepath.Join(root, "overrides"))
+			l := runitLayout{svDir: filepath.Join(root, "etc", "sv"), scanDir: filepath.Join(root, "service")}
+			for _, d := range []string{l.svDir, l.scanDir} {
+				if err := os.MkdirAll(d, 0o755); err != nil {
+					t.Fatal(err)
+				}
+			}
+			runitLayouts = []runitLayout{l}
+
+			p := Params{Binary: "/usr/bin/mullvad-daemon", Verbosity: 1, LogDir: filepath.Join(root, "log")}
+			old, _ := Lookup(initpkg.Runit, p)
+			if err := old.Install(); err != nil {
+				t.Fatal(err)
+			}
+			run := filepath.Join(l.service(), "run")
+			data, err := os.ReadFile(run)
+			if err != nil {
+				t.Fatal(err)
+			}
+			edited := string(data) + "# local tweak\n"
+			if err := os.WriteFile(run, []byte(edited), 0o755); err != nil {
+				t.Fatal(err)
+			}
+
+			Teardown(old, tt.keepFiles)
+			p.Verbosity = 2
+			upgraded, _ := Lookup(initpkg.Runit, p)
+			if err := upgraded.Install(); err != nil {
+				t.Fatal(err)
+			}
+
+			data, _ = os.ReadFile(run)
+			if kept := string(data) == edited; kept != tt.keepFiles {
+				t.Errorf("edited run kept = %v, want %v", kept, tt.keepFiles)
+			}
+			if tt.keepFiles {
+				data, err := os.ReadFile(run + ".new")
+				if err != nil || !strings.Contains(string(data), "-vv") {
+					t.Errorf("run.new = %q, %v; want the new version", data, err)
+				}
+			}
+		})
+	}
+}
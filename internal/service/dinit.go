@@ -0,0 +1,104 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+
+	initpkg "github.com/you/mullvad-installer/internal/init"
+	"github.com/you/mullvad-installer/internal/ui"
+)
+
+func init() {
+	register(initpkg.Dinit, func(p Params) Backend { return dinitBackend{p} })
+}
+
+const (
+	dinitDir       = "/etc/dinit.d"
+	dinitBootDir   = dinitDir + "/boot.d"
+	dinitDaemon    = dinitDir + "/" + DaemonName
+	dinitEarlyBoot = dinitDir + "/" + EarlyBootName
+	// dinitLegacy is the name earlier versions installed the daemon under.
+	dinitLegacy = dinitDir + "/mullvad.daemon"
+)
+
+// dinitServiceDirs are searched for the distribution's network service.
+var dinitServiceDirs = []string{dinitDir, "/usr/lib/dinit.d", "/lib/dinit.d"}
+
+// dinitNetwork returns the name of the service that brings networking up:
+// Chimera's network.target, or a plain network service elsewhere. dinit
+// refuses to load a service whose dependency does not exist, so the
+// dependency is only written when one is found.
+func dinitNetwork() string {
+	for _, name := range []string{"network.target", "network", "net"} {
+		for _, dir := range dinitServiceDirs {
+			if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+type dinitBackend struct{ p Params }
+
+func (dinitBackend) Name() initpkg.InitSystem { return initpkg.Dinit }
+
+func (b dinitBackend) Render() ([]File, error) {
+	daemon, err := b.p.templateFile(dinitDaemon, "templates/dinit/mullvad-daemon", 0o644)
+	if err != nil {
+		return nil, err
+	}
+	early, err := b.p.templateFile(dinitEarlyBoot, "templates/early-boot/dinit", 0o644)
+	if err != nil {
+		return nil, err
+	}
+	if net := dinitNetwork(); net != "" {
+		daemon.Data = append(daemon.Data, "depends-on = "+net+"\n"...)
+		early.Data = append(early.Data, "before = "+net+"\n"...)
+	}
+	return []File{daemon, early}, nil
+}
+
+func (b dinitBackend) Install() error {
+	files, err := b.Render()
+	if err != nil {
+		return err
+	}
+	if dinitNetwork() == "" {
+		ui.Warn("no dinit network service found; mullvad-daemon will not wait for networking")
+	}
+	if err := removeFiles([]File{{Path: dinitLegacy}}); err != nil {
+		return err
+	}
+	return b.p.installFiles(files)
+}
+
+// Enable uses `dinitctl enable` for the daemon, which also starts it. The
+// early-boot service is linked into boot's waits-for directory by hand,
+// since it must not run now.
+func (dinitBackend) Enable() error {
+	if err := relink("../"+EarlyBootName, filepath.Join(dinitBootDir, EarlyBootName)); err != nil {
+		return err
+	}
+	return run("dinitctl", "enable", DaemonName)
+}
+
+func (dinitBackend) Start() error { return run("dinitctl", "start", DaemonName) }
+func (dinitBackend) Stop() error  { return run("dinitctl", "stop", DaemonName) }
+
+func (dinitBackend) Status() (bool, error) {
+	return probe("dinitctl", "is-started", DaemonName)
+}
+
+func (dinitBackend) Disable() error {
+	if err := removeFiles([]File{{Path: filepath.Join(dinitBootDir, EarlyBootName)}}); err != nil {
+		return err
+	}
+	return run("dinitctl", "disable", DaemonName)
+}
+
+func (dinitBackend) removed() []File {
+	return []File{{Path: dinitDaemon}, {Path: dinitEarlyBoot}, {Path: dinitLegacy}}
+}
+
+func (b dinitBackend) Remove() error { return removeFiles(b.removed()) }
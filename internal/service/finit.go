@@ -0,0 +1,104 @@
+package service
+
+import (
+	"errors"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	initpkg "github.com/you/mullvad-installer/internal/init"
+)
+
+func init() {
+	register(initpkg.Finit, func(p Params) Backend { return finitBackend{p} })
+}
+
+const (
+	finitDir       = "/etc/finit.d"
+	finitAvailable = finitDir + "/available"
+)
+
+// finitBackend writes .conf files that finit picks up on `initctl reload`.
+// Newer finit keeps them in available/ and enables them with initctl;
+// older releases run whatever is in /etc/finit.d.
+type finitBackend struct{ p Params }
+
+func (finitBackend) Name() initpkg.InitSystem { return initpkg.Finit }
+
+func finitConfDir() string {
+	if isDir(finitAvailable) {
+		return finitAvailable
+	}
+	return finitDir
+}
+
+func (b finitBackend) Render() ([]File, error) {
+	dir := finitConfDir()
+	daemon, err := b.p.templateFile(filepath.Join(dir, DaemonName+".conf"), "templates/finit/mullvad-daemon.conf", 0o644)
+	if err != nil {
+		return nil, err
+	}
+	early, err := b.p.templateFile(filepath.Join(dir, EarlyBootName+".conf"), "templates/early-boot/finit.conf", 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return []File{daemon, early}, nil
+}
+
+func (b finitBackend) Install() error {
+	files, err := b.Render()
+	if err != nil {
+		return err
+	}
+	return b.p.installFiles(files)
+}
+
+// Enable also loads the new configuration. The early-boot task only runs
+// in runlevel S, so reloading does not run it now.
+func (finitBackend) Enable() error {
+	if finitConfDir() == finitAvailable {
+		if err := runAll([]string{"initctl", "enable", DaemonName}, []string{"initctl", "enable", EarlyBootName}); err != nil {
+			return err
+		}
+	}
+	return run("initctl", "reload")
+}
+
+func (finitBackend) Start() error { return run("initctl", "start", DaemonName) }
+func (finitBackend) Stop() error  { return run("initctl", "stop", DaemonName) }
+
+func (finitBackend) Status() (bool, error) {
+	out, err := exec.Command("initctl", "status", DaemonName).Output()
+	if err != nil {
+		var exit *exec.ExitError
+		if errors.As(err, &exit) {
+			return false, nil
+		}
+		return false, err
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		k, v, ok := strings.Cut(line, ":")
+		if ok && strings.TrimSpace(k) == "Status" {
+			return strings.HasPrefix(strings.TrimSpace(v), "running"), nil
+		}
+	}
+	return false, nil
+}
+
+func (finitBackend) Disable() error {
+	if finitConfDir() == finitAvailable {
+		return runAll([]string{"initctl", "disable", DaemonName}, []string{"initctl", "disable", EarlyBootName})
+	}
+	return nil
+}
+
+func (b finitBackend) Remove() error {
+	files, err := b.Render()
+	if err != nil {
+		return err
+	}
+	if err := removeFiles(files); err != nil {
+		return err
+	}
+	return run("initctl", "reload")
+}
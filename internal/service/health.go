@@ -0,0 +1,91 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/you/mullvad-installer/internal/ui"
+)
+
+const (
+	healthPoll   = time.Second
+	healthSettle = 3 * time.Second // how long the checks must keep passing
+)
+
+// socketPath is where the daemon accepts management clients such as the
+// mullvad CLI.
+func (p Params) socketPath() string {
+	if s := p.Env["MULLVAD_RPC_SOCKET_PATH"]; s != "" {
+		return s
+	}
+	return "/var/run/mullvad-vpn"
+}
+
+// WaitHealthy polls until b reports the daemon running, its management
+// socket accepts connections and `mullvad version` succeeds, and all of
+// that still holds healthSettle later, so a daemon that crashes right
+// after starting is caught. It gives up after timeout and returns the
+// check that failed last.
+func WaitHealthy(b Backend, p Params, timeout time.Duration) error {
+	checks := []struct {
+		name string
+		run  func() error
+	}{
+		{"service status", func() error {
+			running, err := b.Status()
+			if err == nil && !running {
+				err = errors.New("not running")
+			}
+			return err
+		}},
+		{"management socket " + p.socketPath(), func() error {
+			c, err := net.DialTimeout("unix", p.socketPath(), healthPoll)
+			if err == nil {
+				c.Close()
+			}
+			return err
+		}},
+		{"mullvad version", func() error {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			out, err := exec.CommandContext(ctx, "mullvad", "version").CombinedOutput()
+			if err != nil {
+				return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(out)))
+			}
+			return nil
+		}},
+	}
+
+	deadline := time.Now().Add(timeout)
+	var healthySince time.Time
+	for {
+		var failed error
+		for _, c := range checks {
+			if err := c.run(); err != nil {
+				failed = fmt.Errorf("%s: %w", c.name, err)
+				break
+			}
+		}
+		switch {
+		case failed != nil:
+			healthySince = time.Time{}
+		case healthySince.IsZero():
+			healthySince = time.Now()
+		case time.Since(healthySince) >= healthSettle:
+			ui.Info(fmt.Sprintf("%s is up and answering", DaemonName))
+			return nil
+		}
+		if time.Now().After(deadline) {
+			if failed == nil {
+				failed = errors.New("did not stay healthy long enough")
+			}
+			return fmt.Errorf("%s is not healthy after %s: %w", DaemonName, timeout, failed)
+		}
+		time.Sleep(healthPoll)
+	}
+}
@@ -0,0 +1,34 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	initpkg "github.com/you/mullvad-installer/internal/init"
+)
+
+type fakeBackend struct {
+	Backend
+	running bool
+}
+
+func (fakeBackend) Name() initpkg.InitSystem { return "fake" }
+
+func (f fakeBackend) Status() (bool, error) { return f.running, nil }
+
+func TestWaitHealthyReportsFailedCheck(t *testing.T) {
+	p := Params{Env: map[string]string{"MULLVAD_RPC_SOCKET_PATH": t.TempDir() + "/sock"}}
+	tests := []struct {
+		b    fakeBackend
+		want string
+	}{
+		{fakeBackend{running: false}, "service status: not running"},
+		{fakeBackend{running: true}, "management socket " + p.socketPath()},
+	}
+	for _, tt := range tests {
+		err := WaitHealthy(tt.b, p, 0)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("WaitHealthy(running=%v) = %v, want it to mention %q", tt.b.running, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package service
+
+import (
+	initpkg "github.com/you/mullvad-installer/internal/init"
+)
+
+func init() {
+	register(initpkg.OpenRC, func(p Params) Backend { return openrcBackend{p} })
+}
+
+const (
+	openrcScript    = "/etc/init.d/" + DaemonName
+	openrcEarlyBoot = "/etc/init.d/" + EarlyBootName
+)
+
+type openrcBackend struct{ p Params }
+
+func (openrcBackend) Name() initpkg.InitSystem { return initpkg.OpenRC }
+
+func (b openrcBackend) Render() ([]File, error) {
+	daemon, err := b.p.templateFile(openrcScript, "templates/openrc/service", 0o755)
+	if err != nil {
+		return nil, err
+	}
+	early, err := b.p.templateFile(openrcEarlyBoot, "templates/early-boot/openrc", 0o755)
+	if err != nil {
+		return nil, err
+	}
+	return []File{daemon, early}, nil
+}
+
+func (b openrcBackend) Install() error {
+	files, err := b.Render()
+	if err != nil {
+		return err
+	}
+	return writeFiles(files)
+}
+
+func (openrcBackend) Enable() error {
+	return runAll(
+		[]string{"rc-update", "add", DaemonName, "default"},
+		[]string{"rc-update", "add", EarlyBootName, "boot"},
+	)
+}
+
+func (openrcBackend) Start() error { return run("rc-service", DaemonName, "start") }
+func (openrcBackend) Stop() error  { return run("rc-service", DaemonName, "stop") }
+
+func (openrcBackend) Status() (bool, error) {
+	return probe("rc-service", DaemonName, "status")
+}
+
+func (openrcBackend) Disable() error {
+	return runAll(
+		[]string{"rc-update", "del", DaemonName, "default"},
+		[]string{"rc-update", "del", EarlyBootName, "boot"},
+	)
+}
+
+func (b openrcBackend) Remove() error {
+	files, err := b.Render()
+	if err != nil {
+		return err
+	}
+	return removeFiles(files)
+}
@@ -0,0 +1,144 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template/parse"
+)
+
+// overrideDir holds admin replacements for the embedded templates, laid
+// out as <overrideDir>/<init>/<template path below templates/<init>/>.
+// Templates shared between inits, such as early-boot/runit.sh, keep their
+// full path: <overrideDir>/runit/early-boot/runit.sh.
+var overrideDir = "/etc/mullvad-installer/templates"
+
+var ErrBadOverride = errors.New("template override is missing required placeholders")
+
+// placeholderGroups are sets of interchangeable parameters. When the
+// embedded template uses one from a group, an override has to use one as
+// well, or settings such as --daemon-env would silently stop applying.
+var placeholderGroups = [][]string{
+	{"Binary", "Command", "Argv"},
+	{"Args", "Command", "Argv"},
+	{"LogDir", "LogFile"},
+	{"Env", "EnvPairs"},
+}
+
+func (p Params) overridePath(tpl string) string {
+	rel := strings.TrimPrefix(tpl, "templates/")
+	rel = strings.TrimPrefix(rel, string(p.init)+"/")
+	return filepath.Join(overrideDir, string(p.init), rel)
+}
+
+// loadTemplate returns the text of tpl and where it came from: the admin's
+// override if there is one, the embedded template otherwise.
+func (p Params) loadTemplate(tpl string) (text []byte, source string, err error) {
+	builtin, err := templates.ReadFile(tpl)
+	if err != nil {
+		return nil, "", fmt.Errorf("read template %q: %w", tpl, err)
+	}
+	path := p.overridePath(tpl)
+	override, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return builtin, "embedded:" + tpl, nil
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("read template override: %w", err)
+	}
+	if err := checkPlaceholders(path, override, builtin); err != nil {
+		return nil, "", err
+	}
+	return override, path, nil
+}
+
+func checkPlaceholders(name string, override, builtin []byte) error {
+	want, err := templateFields(string(builtin))
+	if err != nil {
+		return err
+	}
+	have, err := templateFields(string(override))
+	if err != nil {
+		return fmt.Errorf("parse template %s: %w", name, err)
+	}
+	var missing []string
+	for _, group := range placeholderGroups {
+		if anyOf(want, group) && !anyOf(have, group) {
+			missing = append(missing, "{{."+strings.Join(group, "}} or {{.")+"}}")
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%w: %s needs %s", ErrBadOverride, name, strings.Join(missing, "; "))
+	}
+	return nil
+}
+
+func anyOf(fields map[string]bool, names []string) bool {
+	for _, n := range names {
+		if fields[n] {
+			return true
+		}
+	}
+	return false
+}
+
+// templateFields returns the names of the Params fields and methods text
+// refers to, as .Name or $.Name.
+func templateFields(text string) (map[string]bool, error) {
+	trees, err := parse.Parse("t", text, "", "", templateFuncs)
+	if err != nil {
+		return nil, err
+	}
+	fields := map[string]bool{}
+	var walk func(n parse.Node)
+	walk = func(n parse.Node) {
+		switch n := n.(type) {
+		case *parse.ListNode:
+			if n == nil {
+				return
+			}
+			for _, c := range n.Nodes {
+				walk(c)
+			}
+		case *parse.ActionNode:
+			walk(n.Pipe)
+		case *parse.IfNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.RangeNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.WithNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.PipeNode:
+			if n == nil {
+				return
+			}
+			for _, c := range n.Cmds {
+				walk(c)
+			}
+		case *parse.CommandNode:
+			for _, a := range n.Args {
+				walk(a)
+			}
+		case *parse.FieldNode:
+			fields[n.Ident[0]] = true
+		case *parse.VariableNode:
+			if n.Ident[0] == "$" && len(n.Ident) > 1 {
+				fields[n.Ident[1]] = true
+			}
+		case *parse.ChainNode:
+			walk(n.Node)
+		}
+	}
+	for _, t := range trees {
+		walk(t.Root)
+	}
+	return fields, nil
+}
@@ -0,0 +1,68 @@
+package service
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	initpkg "github.com/you/mullvad-installer/internal/init"
+)
+
+// setOverrideDir points overrideDir at dir for the rest of the test.
+func setOverrideDir(t *testing.T, dir string) {
+	t.Helper()
+	old := overrideDir
+	t.Cleanup(func() { overrideDir = old })
+	overrideDir = dir
+}
+
+func TestTemplateOverride(t *testing.T) {
+	tests := []struct {
+		name     string
+		override string
+		want     string
+		wantErr  error
+	}{
+		{"none", "", "exec \"$DAEMON\" $OPTS", nil},
+		{"argv", "#!/bin/sh\n{{range .EnvPairs}}export {{shquote .}}\n{{end}}exec {{range .Argv}}{{shquote .}} {{end}}\n", "exec '/usr/bin/mullvad-daemon' '-v'", nil},
+		{"binary only", "#!/bin/sh\nexec {{.Binary}}\n", "", ErrBadOverride},
+		{"no daemon", "#!/bin/sh\nexec sleep 1\n", "", ErrBadOverride},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setOverrideDir(t, t.TempDir())
+			if tt.override != "" {
+				p := filepath.Join(overrideDir, "runit", "runit.run")
+				if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(p, []byte(tt.override), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			p := Params{Binary: "/usr/bin/mullvad-daemon", Verbosity: 1, LogDir: "/var/log/m", init: initpkg.Runit}
+			f, err := p.templateFile("/etc/sv/mullvad-daemon/run", "templates/runit/runit.run", 0o755)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && !strings.Contains(string(f.Data), tt.want) {
+				t.Errorf("rendered:\n%s\nwant it to contain %q", f.Data, tt.want)
+			}
+		})
+	}
+}
+
+func TestOverridePath(t *testing.T) {
+	setOverrideDir(t, "/o")
+	p := Params{init: initpkg.Runit}
+	for tpl, want := range map[string]string{
+		"templates/runit/log/run":       "/o/runit/log/run",
+		"templates/early-boot/runit.sh": "/o/runit/early-boot/runit.sh",
+	} {
+		if got := p.overridePath(tpl); got != want {
+			t.Errorf("overridePath(%q) = %q, want %q", tpl, got, want)
+		}
+	}
+}
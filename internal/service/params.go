@@ -0,0 +1,108 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/you/mullvad-installer/internal/config"
+	initpkg "github.com/you/mullvad-installer/internal/init"
+)
+
+// Params are the values every service template is rendered with.
+type Params struct {
+	Binary       string
+	Verbosity    int // number of -v flags
+	Env          map[string]string
+	LogDir       string
+	NetworkWait  config.NetworkWait
+	RestartDelay time.Duration
+
+	Hardening    bool     // systemd only
+	UnitSettings []string // systemd only, extra [Service] directives
+
+	Requires []string // services the daemon waits for, where the backend found any
+
+	init initpkg.InitSystem // picks the override directory, set by Lookup
+}
+
+func ParamsFromConfig(cfg *config.Config) Params {
+	return Params{
+		Binary:       cfg.DaemonPath,
+		Verbosity:    cfg.DaemonVerbosity,
+		Env:          cfg.DaemonEnv,
+		LogDir:       cfg.LogDir,
+		NetworkWait:  cfg.NetworkWait,
+		RestartDelay: cfg.RestartDelay,
+		Hardening:    cfg.SystemdHardening,
+		UnitSettings: cfg.SystemdSettings,
+	}
+}
+
+// Args are the daemon's arguments, without the binary.
+func (p Params) Args() []string {
+	var args []string
+	if p.Verbosity > 0 {
+		args = append(args, "-"+strings.Repeat("v", p.Verbosity))
+	}
+	return append(args, "--disable-stdout-timestamps")
+}
+
+// Argv is the binary followed by Args.
+func (p Params) Argv() []string { return append([]string{p.Binary}, p.Args()...) }
+
+// Command is Argv joined by spaces, for formats that split on whitespace.
+func (p Params) Command() string { return strings.Join(p.Argv(), " ") }
+
+// LogFile is where inits without a log rotator of their own send output.
+func (p Params) LogFile() string { return filepath.Join(p.LogDir, "daemon.log") }
+
+// Comm is what /proc/<pid>/comm shows for the daemon.
+func (p Params) Comm() string {
+	c := filepath.Base(p.Binary)
+	if len(c) > 15 {
+		c = c[:15]
+	}
+	return c
+}
+
+func (p Params) RestartSeconds() int { return int(p.RestartDelay.Round(time.Second) / time.Second) }
+
+// EnvPairs are the entries of Env as sorted KEY=VALUE strings.
+func (p Params) EnvPairs() []string {
+	pairs := make([]string, 0, len(p.Env))
+	for k, v := range p.Env {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return pairs
+}
+
+var templateFuncs = template.FuncMap{
+	"quote":   strconv.Quote,
+	"shquote": shquote,
+	"join":    strings.Join,
+	"seconds": func(d time.Duration) int { return int(d.Round(time.Second) / time.Second) },
+}
+
+// shquote quotes s for a POSIX shell.
+func shquote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func (p Params) render(name string, text []byte) ([]byte, error) {
+	tpl, err := template.New(name).Funcs(templateFuncs).Option("missingkey=error").Parse(string(text))
+	if err != nil {
+		return nil, fmt.Errorf("parse template %q: %w", name, err)
+	}
+	var buf bytes.Buffer
+	if err := tpl.Execute(&buf, p); err != nil {
+		return nil, fmt.Errorf("render template %q: %w", name, err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,164 @@
+package service
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	initpkg "github.com/you/mullvad-installer/internal/init"
+	"github.com/you/mullvad-installer/internal/ui"
+)
+
+func init() {
+	register(initpkg.Runit, func(p Params) Backend { return runitBackend{p} })
+}
+
+const (
+	runitCoreServices = "/etc/runit/core-services"
+	runitEarlyBoot    = runitCoreServices + "/09-" + EarlyBootName + ".sh"
+)
+
+// runitLayout is where a distribution keeps service definitions and which
+// directory runsvdir scans for enabled ones.
+type runitLayout struct {
+	svDir   string
+	scanDir string
+}
+
+// runitLayouts are the known layouts, checked in order when no runsvdir is
+// running to ask.
+var runitLayouts = []runitLayout{
+	{"/etc/runit/sv", "/run/runit/service"}, // Artix
+	{"/etc/sv", "/var/service"},             // Void
+	{"/etc/sv", "/etc/service"},             // Gentoo, Debian
+	{"/etc/sv", "/service"},                 // daemontools style
+}
+
+// currentRunitLayout prefers the scan directory of the running runsvdir,
+// then the first known layout whose scan directory exists, then Void's.
+func currentRunitLayout() runitLayout {
+	if scan := runsvdirScanDir(); scan != "" {
+		for _, l := range runitLayouts {
+			if sameDir(l.scanDir, scan) {
+				return l
+			}
+		}
+		l := runitLayout{svDir: "/etc/sv", scanDir: scan}
+		if isDir("/etc/runit/sv") {
+			l.svDir = "/etc/runit/sv"
+		}
+		return l
+	}
+	for _, l := range runitLayouts {
+		if isDir(l.scanDir) && isDir(l.svDir) {
+			return l
+		}
+	}
+	return runitLayouts[1]
+}
+
+// runsvdirScanDir returns the directory argument of a running runsvdir,
+// or "" if there is none.
+func runsvdirScanDir() string {
+	_, args := findProcess("runsvdir")
+	// runsvdir [-P] dir [log]
+	for _, a := range args {
+		if !strings.HasPrefix(a, "-") {
+			return a
+		}
+	}
+	return ""
+}
+
+func sameDir(a, b string) bool {
+	if a == b {
+		return true
+	}
+	ra, errA := filepath.EvalSymlinks(a)
+	rb, errB := filepath.EvalSymlinks(b)
+	return errA == nil && errB == nil && ra == rb
+}
+
+func isDir(p string) bool {
+	fi, err := os.Stat(p)
+	return err == nil && fi.IsDir()
+}
+
+type runitBackend struct{ p Params }
+
+func (runitBackend) Name() initpkg.InitSystem { return initpkg.Runit }
+
+func (l runitLayout) service() string { return filepath.Join(l.svDir, DaemonName) }
+func (l runitLayout) link() string    { return filepath.Join(l.scanDir, DaemonName) }
+
+func (b runitBackend) Render() ([]File, error) {
+	l := currentRunitLayout()
+	files, err := b.p.templateTree("templates/runit", l.service(), map[string]string{"runit.run": "run"})
+	if err != nil {
+		return nil, err
+	}
+	// runit has no ordering between services; stage 1 core-services run
+	// before any of them, networking included. Without that directory there
+	// is nowhere early enough to hook in.
+	if isDir(runitCoreServices) {
+		f, err := b.p.templateFile(runitEarlyBoot, "templates/early-boot/runit.sh", 0o644)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+func (b runitBackend) Install() error {
+	files, err := b.Render()
+	if err != nil {
+		return err
+	}
+	if !isDir(runitCoreServices) {
+		ui.Warn("no ", runitCoreServices, " to run before networking; early-boot blocking is not installed")
+	}
+	return b.p.installFiles(files)
+}
+
+func (runitBackend) Enable() error {
+	l := currentRunitLayout()
+	return relink(l.service(), l.link())
+}
+
+// Start waits for runsvdir, which rescans every five seconds, to pick up
+// the link Enable made; sv fails while no runsv is watching the service.
+func (runitBackend) Start() error {
+	link := currentRunitLayout().link()
+	if err := waitSupervised(link, supervisedTimeout); err != nil {
+		return err
+	}
+	return run("sv", "up", link)
+}
+
+func (runitBackend) Stop() error    { return run("sv", "stop", currentRunitLayout().link()) }
+func (runitBackend) Disable() error { return removeFiles([]File{{Path: currentRunitLayout().link()}}) }
+
+func (runitBackend) Status() (bool, error) {
+	// sv status exits 0 whether the service is up or down.
+	out, err := exec.Command("sv", "status", currentRunitLayout().link()).Output()
+	if err != nil {
+		var exit *exec.ExitError
+		if errors.As(err, &exit) {
+			return false, nil
+		}
+		return false, err
+	}
+	return strings.HasPrefix(string(out), "run:"), nil
+}
+
+func (b runitBackend) Remove() error {
+	files, err := b.Render()
+	if err != nil {
+		return err
+	}
+	files = append(files, File{Path: runitEarlyBoot})
+	return removeServiceDirs(files, currentRunitLayout().service())
+}
@@ -0,0 +1,389 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	initpkg "github.com/you/mullvad-installer/internal/init"
+	"github.com/you/mullvad-installer/internal/ui"
+)
+
+func init() {
+	register(initpkg.S6, func(p Params) Backend { return s6Backend{p} })
+}
+
+const (
+	s6Logger = DaemonName + "-log"
+	s6rcLive = "/run/s6-rc"
+	s6SvcDir = "/etc/s6/" + DaemonName // plain s6 service directory
+)
+
+// s6Backend manages the daemon through s6-rc where it is set up, and as a
+// plain supervised service directory linked into the s6-svscan scandir
+// otherwise.
+type s6Backend struct{ p Params }
+
+func (s6Backend) Name() initpkg.InitSystem { return initpkg.S6 }
+
+func (b s6Backend) mode() Backend {
+	if l, ok := currentS6rcLayout(); ok {
+		return s6rcBackend{b.p, l}
+	}
+	return s6PlainBackend{b.p, s6ScanDir()}
+}
+
+func (b s6Backend) Render() ([]File, error) { return b.mode().Render() }
+func (b s6Backend) Install() error          { return b.mode().Install() }
+func (b s6Backend) Enable() error           { return b.mode().Enable() }
+func (b s6Backend) Start() error            { return b.mode().Start() }
+func (b s6Backend) Stop() error             { return b.mode().Stop() }
+func (b s6Backend) Status() (bool, error)   { return b.mode().Status() }
+func (b s6Backend) Disable() error          { return b.mode().Disable() }
+func (b s6Backend) Remove() error           { return b.mode().Remove() }
+
+// s6rcLayout is where a distribution keeps s6-rc source definitions and
+// the compiled database it boots from.
+type s6rcLayout struct {
+	svDir    string   // where our source definitions go
+	sources  []string // every source directory compiled into the database
+	bundle   string   // contents.d of the bundle started at boot
+	compiled string   // symlink to the boot database
+}
+
+var s6rcLayouts = []s6rcLayout{
+	{ // Artix-s6, Obarun
+		svDir:    "/etc/s6/sv",
+		sources:  []string{"/etc/s6/sv", "/etc/s6/adminsv"},
+		bundle:   "/etc/s6/adminsv/default/contents.d",
+		compiled: "/etc/s6/rc/compiled",
+	},
+	{ // s6-rc's own defaults
+		svDir:    "/etc/s6-rc/source",
+		sources:  []string{"/etc/s6-rc/source"},
+		bundle:   "/etc/s6-rc/source/default/contents.d",
+		compiled: "/etc/s6-rc/compiled",
+	},
+}
+
+func currentS6rcLayout() (s6rcLayout, bool) {
+	if !haveCmd("s6-rc-compile") {
+		return s6rcLayout{}, false
+	}
+	for _, l := range s6rcLayouts {
+		if isDir(l.svDir) {
+			return l, true
+		}
+	}
+	return s6rcLayout{}, false
+}
+
+// networkDep returns the name of the distribution's network bundle, if
+// any of the usual ones exists.
+func (l s6rcLayout) networkDep() string {
+	for _, name := range []string{"network", "networking", "net"} {
+		for _, src := range l.sources {
+			if isDir(filepath.Join(src, name)) {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+// earlyBootHooks order the early-boot oneshot before networking. s6-rc has
+// no "before", so every atomic service behind the network bundle gets a
+// dependency on the oneshot instead.
+func (l s6rcLayout) earlyBootHooks() []File {
+	net := l.networkDep()
+	if net == "" {
+		return nil
+	}
+	var files []File
+	for _, dir := range l.atomics(net, map[string]bool{}) {
+		files = append(files, File{Path: filepath.Join(dir, "dependencies.d", EarlyBootName), Mode: 0o644})
+	}
+	return files
+}
+
+// atomics returns the definition directories of the longruns and oneshots
+// that name stands for: itself, or the members of a bundle, recursively.
+func (l s6rcLayout) atomics(name string, seen map[string]bool) []string {
+	dir := l.definition(name)
+	if dir == "" || seen[name] {
+		return nil
+	}
+	seen[name] = true
+	typ, _ := os.ReadFile(filepath.Join(dir, "type"))
+	if strings.TrimSpace(string(typ)) != "bundle" {
+		return []string{dir}
+	}
+	var dirs []string
+	for _, member := range bundleMembers(dir) {
+		dirs = append(dirs, l.atomics(member, seen)...)
+	}
+	return dirs
+}
+
+func (l s6rcLayout) definition(name string) string {
+	for _, src := range l.sources {
+		if dir := filepath.Join(src, name); isDir(dir) {
+			return dir
+		}
+	}
+	return ""
+}
+
+// bundleMembers reads a bundle's contents.d, or the contents file older
+// s6-rc versions use.
+func bundleMembers(dir string) []string {
+	var members []string
+	if entries, err := os.ReadDir(filepath.Join(dir, "contents.d")); err == nil {
+		for _, e := range entries {
+			members = append(members, e.Name())
+		}
+		return members
+	}
+	data, _ := os.ReadFile(filepath.Join(dir, "contents"))
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			members = append(members, line)
+		}
+	}
+	return members
+}
+
+// reload compiles a fresh database from every source directory, switches
+// the live system to it and points the boot symlink at it. Artix ships
+// s6-db-reload, which does all of that its own way.
+func (l s6rcLayout) reload() error {
+	if haveCmd("s6-db-reload") {
+		return run("s6-db-reload")
+	}
+	var sources []string
+	for _, src := range l.sources {
+		if isDir(src) {
+			sources = append(sources, src)
+		}
+	}
+	db := fmt.Sprintf("%s-%d", l.compiled, time.Now().Unix())
+	if err := run(append([]string{"s6-rc-compile", db}, sources...)...); err != nil {
+		return err
+	}
+	if isDir(s6rcLive) {
+		if err := run("s6-rc-update", db); err != nil {
+			return err
+		}
+	}
+	return relink(db, l.compiled)
+}
+
+type s6rcBackend struct {
+	p Params
+	l s6rcLayout
+}
+
+func (s6rcBackend) Name() initpkg.InitSystem { return initpkg.S6 }
+
+func (b s6rcBackend) Render() ([]File, error) {
+	run, err := b.p.templateFile(filepath.Join(b.l.svDir, DaemonName, "run"), "templates/s6/run", 0o755)
+	if err != nil {
+		return nil, err
+	}
+	logRun, err := b.p.templateFile(filepath.Join(b.l.svDir, s6Logger, "run"), "templates/s6/log/run", 0o755)
+	if err != nil {
+		return nil, err
+	}
+	early, err := b.p.templateTree("templates/early-boot/s6", filepath.Join(b.l.svDir, EarlyBootName), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	text := func(svc, name, content string) File {
+		return File{Path: filepath.Join(b.l.svDir, svc, name), Mode: 0o644, Data: []byte(content)}
+	}
+	files := []File{
+		text(DaemonName, "type", "longrun\n"),
+		run,
+		text(DaemonName, "producer-for", s6Logger+"\n"),
+		text(s6Logger, "type", "longrun\n"),
+		logRun,
+		text(s6Logger, "consumer-for", DaemonName+"\n"),
+	}
+	if dep := b.l.networkDep(); dep != "" {
+		files = append(files, text(DaemonName, "dependencies.d/"+dep, ""))
+	}
+	files = append(files, early...)
+	return append(files, b.l.earlyBootHooks()...), nil
+}
+
+func (b s6rcBackend) Install() error {
+	files, err := b.Render()
+	if err != nil {
+		return err
+	}
+	if b.l.networkDep() == "" {
+		ui.Warn("no network bundle found in ", strings.Join(b.l.sources, ", "),
+			"; mullvad-daemon will not wait for networking")
+	}
+	return b.p.installFiles(files)
+}
+
+// Enable adds the services to the boot bundle and recompiles, which also
+// makes the new definitions known to the live system.
+func (b s6rcBackend) Enable() error {
+	for _, svc := range []string{DaemonName, s6Logger, EarlyBootName} {
+		if err := writeFiles([]File{{Path: filepath.Join(b.l.bundle, svc), Mode: 0o644}}); err != nil {
+			return err
+		}
+	}
+	return b.l.reload()
+}
+
+func (s6rcBackend) Start() error { return run("s6-rc", "-u", "change", DaemonName) }
+func (s6rcBackend) Stop() error  { return run("s6-rc", "-d", "change", DaemonName) }
+
+func (s6rcBackend) Status() (bool, error) {
+	out, err := exec.Command("s6-rc", "-a", "list").Output()
+	if err != nil {
+		return false, err
+	}
+	for _, svc := range strings.Fields(string(out)) {
+		if svc == DaemonName {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (b s6rcBackend) Disable() error {
+	var files []File
+	for _, svc := range []string{DaemonName, s6Logger, EarlyBootName} {
+		files = append(files, File{Path: filepath.Join(b.l.bundle, svc)})
+	}
+	if err := removeFiles(files); err != nil {
+		return err
+	}
+	return b.l.reload()
+}
+
+func (b s6rcBackend) Remove() error {
+	files, err := b.Render()
+	if err != nil {
+		return err
+	}
+	var roots []string
+	for _, svc := range []string{DaemonName, s6Logger, EarlyBootName} {
+		roots = append(roots, filepath.Join(b.l.svDir, svc))
+	}
+	if err := removeServiceDirs(files, roots...); err != nil {
+		return err
+	}
+	return b.l.reload()
+}
+
+// s6ScanDirs are the usual s6-svscan scandirs, used when no s6-svscan is
+// running to ask.
+var s6ScanDirs = []string{"/run/service", "/service", "/etc/service", "/var/service"}
+
+// s6ScanDir returns the scandir of the running s6-svscan: its directory
+// argument, or its working directory when it was started without one.
+func s6ScanDir() string {
+	pid, args := findProcess("s6-svscan")
+	if pid != "" {
+		for i := 0; i < len(args); i++ {
+			switch a := args[i]; {
+			case a == "-c" || a == "-t" || a == "-d" || a == "-X":
+				i++
+			case strings.HasPrefix(a, "-"):
+			default:
+				return a
+			}
+		}
+		if cwd, err := os.Readlink("/proc/" + pid + "/cwd"); err == nil {
+			return cwd
+		}
+	}
+	for _, d := range s6ScanDirs {
+		if isDir(d) {
+			return d
+		}
+	}
+	return s6ScanDirs[0]
+}
+
+// s6PlainBackend supervises the daemon directly under s6-svscan. There are
+// no oneshots without s6-rc, so there is no early-boot blocking either.
+type s6PlainBackend struct {
+	p       Params
+	scanDir string
+}
+
+func (s6PlainBackend) Name() initpkg.InitSystem { return initpkg.S6 }
+
+func (b s6PlainBackend) link() string { return filepath.Join(b.scanDir, DaemonName) }
+
+func (b s6PlainBackend) Render() ([]File, error) {
+	return b.p.templateTree("templates/s6", s6SvcDir, nil)
+}
+
+func (b s6PlainBackend) Install() error {
+	files, err := b.Render()
+	if err != nil {
+		return err
+	}
+	ui.Warn("s6-rc not found; early-boot blocking needs s6-rc and is not installed")
+	return b.p.installFiles(files)
+}
+
+func (b s6PlainBackend) Enable() error {
+	if err := relink(s6SvcDir, b.link()); err != nil {
+		return err
+	}
+	if strings.HasPrefix(b.scanDir, "/run/") {
+		ui.Warn(b.scanDir, " is on tmpfs; add ", DaemonName, " to your s6 boot image to keep it across reboots")
+	}
+	return run("s6-svscanctl", "-a", b.scanDir)
+}
+
+// Start waits for s6-svscan to start s6-supervise on the new service;
+// s6-svscanctl -a only asks for the rescan.
+func (b s6PlainBackend) Start() error {
+	if err := waitSupervised(b.link(), supervisedTimeout); err != nil {
+		return err
+	}
+	return run("s6-svc", "-u", b.link())
+}
+
+func (b s6PlainBackend) Stop() error { return run("s6-svc", "-d", b.link()) }
+
+func (b s6PlainBackend) Status() (bool, error) {
+	out, err := exec.Command("s6-svstat", "-u", b.link()).Output()
+	if err != nil {
+		var exit *exec.ExitError
+		if errors.As(err, &exit) {
+			return false, nil
+		}
+		return false, err
+	}
+	return strings.TrimSpace(string(out)) == "true", nil
+}
+
+func (b s6PlainBackend) Disable() error {
+	if err := removeFiles([]File{{Path: b.link()}}); err != nil {
+		return err
+	}
+	return run("s6-svscanctl", "-an", b.scanDir)
+}
+
+func (b s6PlainBackend) Remove() error {
+	files, err := b.Render()
+	if err != nil {
+		return err
+	}
+	return removeServiceDirs(files, s6SvcDir)
+}
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	initpkg "github.com/you/mullvad-installer/internal/init"
+)
+
+// mkS6rcDef writes an s6-rc source definition: its type file, then each
+// extra "name" => "content" file.
+func mkS6rcDef(t *testing.T, dir, typ string, extra map[string]string) {
+	t.Helper()
+	files := map[string]string{"type": typ + "\n"}
+	for name, content := range extra {
+		files[name] = content
+	}
+	for name, content := range files {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestS6rcEarlyBootBeforeNetwork(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(t *testing.T, sv, adminsv string)
+		want  []string // definitions that must depend on the early-boot oneshot
+	}{
+		{
+			name: "network bundle",
+			setup: func(t *testing.T, sv, adminsv string) {
+				mkS6rcDef(t, filepath.Join(sv, "network"), "bundle", map[string]string{
+					"contents.d/dhcpcd": "", "contents.d/wifi": "",
+				})
+				mkS6rcDef(t, filepath.Join(sv, "dhcpcd"), "longrun", nil)
+				// A nested bundle, with the older contents file.
+				mkS6rcDef(t, filepath.Join(adminsv, "wifi"), "bundle", map[string]string{"contents": "iwd\n# comment\n"})
+				mkS6rcDef(t, filepath.Join(sv, "iwd"), "longrun", nil)
+			},
+			want: []string{"sv/dhcpcd", "sv/iwd"},
+		},
+		{
+			name: "network oneshot",
+			setup: func(t *testing.T, sv, _ string) {
+				mkS6rcDef(t, filepath.Join(sv, "networking"), "oneshot", map[string]string{"up": "ifup -a\n"})
+			},
+			want: []string{"sv/networking"},
+		},
+		{
+			name:  "no network",
+			setup: func(*testing.T, string, string) {},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			sv, adminsv := filepath.Join(root, "sv"), filepath.Join(root, "adminsv")
+			tt.setup(t, sv, adminsv)
+			setOverrideDir(t, filepath.Join(root, "overrides"))
+			l := s6rcLayout{svDir: sv, sources: []string{sv, adminsv}}
+			files, err := s6rcBackend{Params{Binary: "/usr/bin/mullvad-daemon", LogDir: "/var/log/m", init: initpkg.S6}, l}.Render()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, f := range files {
+				if filepath.Base(f.Path) == EarlyBootName && filepath.Base(filepath.Dir(f.Path)) == "dependencies.d" {
+					rel, _ := filepath.Rel(root, filepath.Dir(filepath.Dir(f.Path)))
+					got = append(got, rel)
+				}
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("early-boot dependents = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("early-boot dependents = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
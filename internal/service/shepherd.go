@@ -0,0 +1,103 @@
+package service
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+
+	initpkg "github.com/you/mullvad-installer/internal/init"
+	"github.com/you/mullvad-installer/internal/ui"
+)
+
+func init() {
+	register(initpkg.Shepherd, func(p Params) Backend { return shepherdBackend{p} })
+}
+
+const (
+	shepherdFile = "/etc/shepherd/" + DaemonName + ".scm"
+	// shepherdInit is the configuration a standalone Shepherd boots from.
+	// Guix System generates its own from the system declaration instead.
+	shepherdInit = "/etc/shepherd/init.scm"
+)
+
+// shepherdBackend loads a service definition into the running Shepherd
+// with herd. Shepherd cannot order a service before networking, so there
+// is no early-boot blocking.
+type shepherdBackend struct{ p Params }
+
+func (shepherdBackend) Name() initpkg.InitSystem { return initpkg.Shepherd }
+
+// shepherdNetwork returns the running Shepherd's network service. Guix
+// System always has networking; a standalone Shepherd may have none, and
+// then a requirement on it would keep the daemon from starting.
+var shepherdNetwork = func() string {
+	for _, name := range []string{"networking", "network"} {
+		if ok, _ := probe("herd", "status", name); ok {
+			return name
+		}
+	}
+	return ""
+}
+
+func (b shepherdBackend) Render() ([]File, error) {
+	p := b.p
+	if net := shepherdNetwork(); net != "" {
+		p.Requires = []string{net}
+	}
+	f, err := p.templateFile(shepherdFile, "templates/shepherd/mullvad-daemon.scm", 0o644)
+	return []File{f}, err
+}
+
+func (b shepherdBackend) Install() error {
+	files, err := b.Render()
+	if err != nil {
+		return err
+	}
+	ui.Warn("Shepherd cannot start services before networking; early-boot blocking is not installed")
+	return b.p.installFiles(files)
+}
+
+func (shepherdBackend) Enable() error {
+	if _, err := os.Stat(shepherdInit); err != nil {
+		ui.Warn("no ", shepherdInit, "; on Guix System add ", shepherdFile,
+			" to your system configuration to start it on boot")
+		return nil
+	}
+	return schemeBlock.add(shepherdInit, `(load "`+shepherdFile+`")`+"\n", "")
+}
+
+// Start registers the service with the running Shepherd unless it already
+// knows it, then starts it.
+func (shepherdBackend) Start() error {
+	if known, _ := probe("herd", "status", DaemonName); !known {
+		if err := run("herd", "load", "root", shepherdFile); err != nil {
+			return err
+		}
+	}
+	return run("herd", "start", DaemonName)
+}
+
+func (shepherdBackend) Stop() error { return run("herd", "stop", DaemonName) }
+
+func (shepherdBackend) Status() (bool, error) {
+	out, err := exec.Command("herd", "status", DaemonName).Output()
+	if err != nil {
+		var exit *exec.ExitError
+		if errors.As(err, &exit) {
+			return false, nil
+		}
+		return false, err
+	}
+	return strings.Contains(string(out), "It is running") ||
+		strings.Contains(string(out), "It is started"), nil
+}
+
+func (shepherdBackend) Disable() error { return schemeBlock.remove(shepherdInit) }
+
+func (shepherdBackend) Remove() error {
+	// Older Shepherds cannot unload; the definition then stays registered
+	// until the next boot, stopped.
+	_ = run("herd", "unload", "root", DaemonName)
+	return removeFiles([]File{{Path: shepherdFile}})
+}
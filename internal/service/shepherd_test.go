@@ -0,0 +1,37 @@
+package service
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	initpkg "github.com/you/mullvad-installer/internal/init"
+)
+
+func TestShepherdNetworkRequirement(t *testing.T) {
+	old := shepherdNetwork
+	t.Cleanup(func() { shepherdNetwork = old })
+	setOverrideDir(t, filepath.Join(t.TempDir(), "overrides"))
+	p := Params{Binary: "/usr/bin/mullvad-daemon", LogDir: "/var/log/m", init: initpkg.Shepherd}
+
+	for _, tt := range []struct {
+		network string
+		want    string // "" means no requirement at all
+	}{
+		{"networking", "#:requirement '(networking)"},
+		{"", ""},
+	} {
+		shepherdNetwork = func() string { return tt.network }
+		files, err := shepherdBackend{p}.Render()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := string(files[0].Data)
+		if tt.want == "" && strings.Contains(got, "#:requirement") {
+			t.Errorf("without a network service, rendered:\n%s", got)
+		}
+		if tt.want != "" && !strings.Contains(got, tt.want) {
+			t.Errorf("with %s, want %q in:\n%s", tt.network, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package service
+
+import (
+	"errors"
+	"os/exec"
+	"strings"
+
+	initpkg "github.com/you/mullvad-installer/internal/init"
+	"github.com/you/mullvad-installer/internal/ui"
+)
+
+func init() {
+	register(initpkg.Suite66, func(p Params) Backend { return suite66Backend{p} })
+}
+
+const (
+	suite66Frontend = "/etc/66/service/" + DaemonName
+	// suite66Live is where 66 keeps root's live s6 scandir.
+	suite66Live = "/run/66/scandir/0/" + DaemonName
+)
+
+// suite66Backend writes a 66 frontend file and enables it in the default
+// tree, which 66 brings up at boot. 66 has no way to order a service before
+// networking, so there is no early-boot blocking.
+type suite66Backend struct{ p Params }
+
+func (suite66Backend) Name() initpkg.InitSystem { return initpkg.Suite66 }
+
+// cmd66 spells a 66 command for both the single `66` binary of 0.7 and
+// later and the separate 66-enable, 66-start, ... tools before it.
+func cmd66(verb string) []string {
+	if haveCmd("66") {
+		return []string{"66", verb, DaemonName}
+	}
+	return []string{"66-" + verb, DaemonName}
+}
+
+func (b suite66Backend) Render() ([]File, error) {
+	f, err := b.p.templateFile(suite66Frontend, "templates/66/mullvad-daemon", 0o644)
+	return []File{f}, err
+}
+
+func (b suite66Backend) Install() error {
+	files, err := b.Render()
+	if err != nil {
+		return err
+	}
+	ui.Warn("66 cannot start services before networking; early-boot blocking is not installed")
+	return b.p.installFiles(files)
+}
+
+func (suite66Backend) Enable() error  { return run(cmd66("enable")...) }
+func (suite66Backend) Start() error   { return run(cmd66("start")...) }
+func (suite66Backend) Stop() error    { return run(cmd66("stop")...) }
+func (suite66Backend) Disable() error { return run(cmd66("disable")...) }
+
+// Status asks s6 directly; the output of 66's own status commands changed
+// between releases.
+func (suite66Backend) Status() (bool, error) {
+	out, err := exec.Command("s6-svstat", "-u", suite66Live).Output()
+	if err != nil {
+		var exit *exec.ExitError
+		if errors.As(err, &exit) {
+			return false, nil
+		}
+		return false, err
+	}
+	return strings.TrimSpace(string(out)) == "true", nil
+}
+
+func (suite66Backend) Remove() error { return removeFiles([]File{{Path: suite66Frontend}}) }
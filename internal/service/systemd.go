@@ -0,0 +1,210 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	initpkg "github.com/you/mullvad-installer/internal/init"
+	"github.com/you/mullvad-installer/internal/ui"
+)
+
+func init() {
+	register(initpkg.Systemd, func(p Params) Backend { return systemdBackend{p} })
+}
+
+const (
+	systemdUnitDir   = "/usr/lib/systemd/system"
+	systemdLocalUnit = "/etc/systemd/system/mullvad-daemon.service"
+	systemdDaemon    = DaemonName + ".service"
+	systemdEarlyBoot = EarlyBootName + ".service"
+	systemdDropIn    = "/etc/systemd/system/" + systemdDaemon + ".d/mullvad-installer.conf"
+)
+
+// upstreamUnitSources are where the package may have put its units, most
+// preferred first. Older releases keep them under resources/ only.
+var upstreamUnitSources = []string{
+	systemdUnitDir,
+	"/lib/systemd/system",
+	"/opt/Mullvad VPN/resources",
+}
+
+// systemdBackend prefers the units from the package and falls back to the
+// embedded template when the package has none. The package ships its own
+// early-boot unit. Upstream units are installed as shipped; the daemon's
+// environment and site policy go into a drop-in beside whichever unit is
+// used, while the other parameters only reach the fallback unit.
+type systemdBackend struct{ p Params }
+
+func (systemdBackend) Name() initpkg.InitSystem { return initpkg.Systemd }
+
+func (b systemdBackend) Render() ([]File, error) {
+	files, err := b.units()
+	if err != nil || !b.wantDropIn() {
+		return files, err
+	}
+	f, err := b.p.templateFile(systemdDropIn, "templates/systemd/dropin", 0o644)
+	return append(files, f), err
+}
+
+func (b systemdBackend) wantDropIn() bool {
+	return len(b.p.Env) > 0 || b.p.Hardening || len(b.p.UnitSettings) > 0
+}
+
+func (b systemdBackend) units() ([]File, error) {
+	upstream := upstreamUnits()
+	if len(upstream) == 0 {
+		f, err := b.p.templateFile(systemdLocalUnit, "templates/systemd/unit", 0o644)
+		return []File{f}, err
+	}
+	var files []File
+	for _, name := range []string{systemdDaemon, systemdEarlyBoot} {
+		src, ok := upstream[name]
+		dst := filepath.Join(systemdUnitDir, name)
+		if !ok || src == dst {
+			continue
+		}
+		data, err := os.ReadFile(src)
+		if err != nil {
+			return nil, fmt.Errorf("install %s: %w", name, err)
+		}
+		files = append(files, File{Path: dst, Mode: 0o644, Data: data})
+	}
+	return files, nil
+}
+
+// Install writes the units and drop-in and checks them with
+// systemd-analyze verify, putting the previous files back if they fail.
+func (b systemdBackend) Install() error {
+	files, err := b.Render()
+	if err != nil {
+		return err
+	}
+	restore, err := snapshotFiles(append(files, File{Path: systemdLocalUnit}, File{Path: systemdDropIn}))
+	if err != nil {
+		return err
+	}
+	if err := b.writeUnits(files); err != nil {
+		return errors.Join(err, restore())
+	}
+	if err := b.verify(); err != nil {
+		ui.Warn("systemd rejected the new units; restoring the previous ones")
+		return errors.Join(err, restore(), run("systemctl", "daemon-reload"))
+	}
+	return nil
+}
+
+func (b systemdBackend) writeUnits(files []File) error {
+	if len(upstreamUnits()) > 0 {
+		if err := b.dropStaleLocalUnit(); err != nil {
+			return err
+		}
+	}
+	if !b.wantDropIn() {
+		if err := removeFiles([]File{{Path: systemdDropIn}}); err != nil {
+			return err
+		}
+	}
+	if err := writeFiles(files); err != nil {
+		return err
+	}
+	return run("systemctl", "daemon-reload")
+}
+
+// verify runs systemd-analyze verify on the units we enable, which also
+// reads their drop-ins.
+func (systemdBackend) verify() error {
+	if !haveCmd("systemd-analyze") {
+		ui.Warn("systemd-analyze not found; not verifying the units")
+		return nil
+	}
+	upstream := upstreamUnits()
+	units := []string{systemdLocalUnit}
+	if len(upstream) > 0 {
+		units = []string{filepath.Join(systemdUnitDir, systemdDaemon)}
+		if _, ok := upstream[systemdEarlyBoot]; ok {
+			units = append(units, filepath.Join(systemdUnitDir, systemdEarlyBoot))
+		}
+	}
+	return run(append([]string{"systemd-analyze", "verify"}, units...)...)
+}
+
+func (systemdBackend) Enable() error {
+	cmds := [][]string{{"systemctl", "enable", systemdDaemon}}
+	if _, ok := upstreamUnits()[systemdEarlyBoot]; ok {
+		cmds = append(cmds, []string{"systemctl", "enable", systemdEarlyBoot})
+	}
+	return runAll(cmds...)
+}
+
+func (systemdBackend) Start() error { return run("systemctl", "start", systemdDaemon) }
+func (systemdBackend) Stop() error  { return run("systemctl", "stop", systemdDaemon) }
+
+func (systemdBackend) Status() (bool, error) {
+	return probe("systemctl", "is-active", "--quiet", systemdDaemon)
+}
+
+func (systemdBackend) Disable() error {
+	return runAll([]string{"systemctl", "disable", systemdDaemon}, []string{"systemctl", "disable", systemdEarlyBoot})
+}
+
+// removed lists everything Remove deletes: the drop-in and both units
+// wherever they may be, upstream copies in /usr/lib included.
+func (systemdBackend) removed() []File {
+	files := []File{{Path: systemdDropIn}}
+	for _, unit := range []string{systemdDaemon, systemdEarlyBoot} {
+		files = append(files,
+			File{Path: "/etc/systemd/system/" + unit},
+			File{Path: filepath.Join(systemdUnitDir, unit)})
+	}
+	return files
+}
+
+func (systemdBackend) reload() error { return run("systemctl", "daemon-reload") }
+
+func (b systemdBackend) Remove() error {
+	if err := removeFiles(b.removed()); err != nil {
+		return err
+	}
+	_ = os.Remove(filepath.Dir(systemdDropIn))
+	return b.reload()
+}
+
+// upstreamUnits maps the units the package shipped to where they were found.
+func upstreamUnits() map[string]string {
+	found := map[string]string{}
+	for _, name := range []string{systemdDaemon, systemdEarlyBoot} {
+		for _, dir := range upstreamUnitSources {
+			p := filepath.Join(dir, name)
+			if fi, err := os.Stat(p); err == nil && fi.Mode().IsRegular() {
+				found[name] = p
+				break
+			}
+		}
+	}
+	return found
+}
+
+// dropStaleLocalUnit removes the unit an earlier install wrote to /etc,
+// which would otherwise shadow the upstream one. A unit that differs from
+// our template was edited by someone and is left in place.
+func (b systemdBackend) dropStaleLocalUnit() error {
+	onDisk, err := os.ReadFile(systemdLocalUnit)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read %s: %w", systemdLocalUnit, err)
+	}
+	ours, err := b.p.templateFile(systemdLocalUnit, "templates/systemd/unit", 0o644)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(onDisk, ours.Data) {
+		ui.Warn(systemdLocalUnit, " has local changes and overrides the upstream unit; leaving it")
+		return nil
+	}
+	return os.Remove(systemdLocalUnit)
+}
@@ -0,0 +1,230 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	initpkg "github.com/you/mullvad-installer/internal/init"
+	"github.com/you/mullvad-installer/internal/ui"
+)
+
+func init() {
+	register(initpkg.SysV, func(p Params) Backend { return sysvBackend{p} })
+}
+
+const (
+	sysvScript    = "/etc/init.d/" + DaemonName
+	sysvEarlyBoot = "/etc/init.d/" + EarlyBootName
+
+	slackScript        = "/etc/rc.d/rc.mullvad"
+	slackRcLocal       = "/etc/rc.d/rc.local"
+	slackRcLocalStop   = "/etc/rc.d/rc.local_shutdown"
+	sysvManualStartSeq = "20"
+	sysvManualStopSeq  = "80"
+)
+
+// sysvBackend handles LSB-style /etc/init.d systems, and Slackware, whose
+// BSD-style rc scripts are enabled by being executable and started from
+// rc.local.
+type sysvBackend struct{ p Params }
+
+func (sysvBackend) Name() initpkg.InitSystem { return initpkg.SysV }
+
+func (b sysvBackend) mode() Backend {
+	if isSlackware() {
+		return slackBackend{b.p}
+	}
+	return lsbBackend{b.p}
+}
+
+func isSlackware() bool {
+	for _, p := range []string{"/etc/slackware-version", "/etc/rc.d/rc.M"} {
+		if _, err := os.Stat(p); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (b sysvBackend) Render() ([]File, error) { return b.mode().Render() }
+func (b sysvBackend) Install() error          { return b.mode().Install() }
+func (b sysvBackend) Enable() error           { return b.mode().Enable() }
+func (b sysvBackend) Start() error            { return b.mode().Start() }
+func (b sysvBackend) Stop() error             { return b.mode().Stop() }
+func (b sysvBackend) Status() (bool, error)   { return b.mode().Status() }
+func (b sysvBackend) Disable() error          { return b.mode().Disable() }
+func (b sysvBackend) Remove() error           { return b.mode().Remove() }
+
+type lsbBackend struct{ p Params }
+
+func (lsbBackend) Name() initpkg.InitSystem { return initpkg.SysV }
+
+func (b lsbBackend) Render() ([]File, error) {
+	daemon, err := b.p.templateFile(sysvScript, "templates/sysvinit/init.d", 0o755)
+	if err != nil {
+		return nil, err
+	}
+	early, err := b.p.templateFile(sysvEarlyBoot, "templates/early-boot/sysvinit", 0o755)
+	if err != nil {
+		return nil, err
+	}
+	return []File{daemon, early}, nil
+}
+
+func (b lsbBackend) Install() error {
+	files, err := b.Render()
+	if err != nil {
+		return err
+	}
+	return writeFiles(files)
+}
+
+func (lsbBackend) Enable() error {
+	if err := sysvEnable(DaemonName, sysvManualStartSeq, []string{"2", "3", "4", "5"}); err != nil {
+		return err
+	}
+	return sysvEnable(EarlyBootName, "01", []string{"S"})
+}
+
+func (lsbBackend) Start() error { return run(sysvScript, "start") }
+func (lsbBackend) Stop() error  { return run(sysvScript, "stop") }
+
+func (lsbBackend) Status() (bool, error) { return probe(sysvScript, "status") }
+
+func (lsbBackend) Disable() error {
+	return errors.Join(sysvDisable(DaemonName), sysvDisable(EarlyBootName))
+}
+
+func (b lsbBackend) Remove() error {
+	files, err := b.Render()
+	if err != nil {
+		return err
+	}
+	return removeFiles(files)
+}
+
+// sysvEnable adds name to the boot sequence with whichever tool the
+// distribution uses; they all read the script's LSB header. Without one,
+// start links go into the given runlevels and stop links into 0, 1 and 6.
+func sysvEnable(name, seq string, runlevels []string) error {
+	switch {
+	case haveCmd("update-rc.d"):
+		return run("update-rc.d", name, "defaults")
+	case haveCmd("chkconfig"):
+		return runAll([]string{"chkconfig", "--add", name}, []string{"chkconfig", name, "on"})
+	case haveCmd("insserv"):
+		return run("insserv", name)
+	}
+
+	base := sysvRcBase()
+	if base == "" {
+		ui.Warn(fmt.Sprintf("no update-rc.d, chkconfig, insserv or rc?.d directories found; enable %s by hand", name))
+		return nil
+	}
+	target := "../init.d/" + name
+	for _, rl := range runlevels {
+		dir := filepath.Join(base, "rc"+rl+".d")
+		if !isDir(dir) {
+			continue
+		}
+		if err := relink(target, filepath.Join(dir, "S"+seq+name)); err != nil {
+			return err
+		}
+	}
+	if runlevels[0] == "S" {
+		return nil
+	}
+	for _, rl := range []string{"0", "1", "6"} {
+		dir := filepath.Join(base, "rc"+rl+".d")
+		if !isDir(dir) {
+			continue
+		}
+		if err := relink(target, filepath.Join(dir, "K"+sysvManualStopSeq+name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sysvDisable(name string) error {
+	switch {
+	case haveCmd("update-rc.d"):
+		return run("update-rc.d", "-f", name, "remove")
+	case haveCmd("chkconfig"):
+		return run("chkconfig", "--del", name)
+	case haveCmd("insserv"):
+		return run("insserv", "-r", name)
+	}
+	base := sysvRcBase()
+	if base == "" {
+		return nil
+	}
+	links, _ := filepath.Glob(filepath.Join(base, "rc?.d", "[SK][0-9][0-9]"+name))
+	var files []File
+	for _, l := range links {
+		files = append(files, File{Path: l})
+	}
+	return removeFiles(files)
+}
+
+// sysvRcBase returns the directory holding the rcN.d link farms: /etc on
+// Debian-likes, /etc/rc.d on Red Hat-likes.
+func sysvRcBase() string {
+	for _, base := range []string{"/etc", "/etc/rc.d"} {
+		if isDir(filepath.Join(base, "rc3.d")) {
+			return base
+		}
+	}
+	return ""
+}
+
+// slackBackend installs rc.mullvad and starts it from rc.local. rc.local
+// runs after networking, and nothing earlier can be hooked without editing
+// the distribution's own scripts, so there is no early-boot blocking.
+type slackBackend struct{ p Params }
+
+func (slackBackend) Name() initpkg.InitSystem { return initpkg.SysV }
+
+func (b slackBackend) Render() ([]File, error) {
+	f, err := b.p.templateFile(slackScript, "templates/sysvinit/init.d", 0o755)
+	return []File{f}, err
+}
+
+func (b slackBackend) Install() error {
+	files, err := b.Render()
+	if err != nil {
+		return err
+	}
+	ui.Warn("Slackware has no hook before networking; early-boot blocking is not installed")
+	return writeFiles(files)
+}
+
+func (slackBackend) Enable() error {
+	if err := os.Chmod(slackScript, 0o755); err != nil {
+		return err
+	}
+	start := "if [ -x " + slackScript + " ]; then\n  " + slackScript + " start\nfi\n"
+	stop := "if [ -x " + slackScript + " ]; then\n  " + slackScript + " stop\nfi\n"
+	if err := shellBlock.add(slackRcLocal, start, "#!/bin/sh\n"); err != nil {
+		return err
+	}
+	return shellBlock.add(slackRcLocalStop, stop, "#!/bin/sh\n")
+}
+
+func (slackBackend) Start() error { return run(slackScript, "start") }
+func (slackBackend) Stop() error  { return run(slackScript, "stop") }
+
+func (slackBackend) Status() (bool, error) { return probe(slackScript, "status") }
+
+// Disable follows Slackware's convention of clearing the executable bit,
+// and takes the hooks out of rc.local again.
+func (slackBackend) Disable() error {
+	if err := os.Chmod(slackScript, 0o644); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return errors.Join(shellBlock.remove(slackRcLocal), shellBlock.remove(slackRcLocalStop))
+}
+
+func (slackBackend) Remove() error { return removeFiles([]File{{Path: slackScript}}) }
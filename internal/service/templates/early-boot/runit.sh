@@ -0,0 +1,6 @@
+# Sourced by runit stage 1 before any network service is started.
+# Blocks traffic until mullvad-daemon takes over the firewall.
+if [ -x {{shquote .Binary}} ]; then
+  msg "Applying Mullvad early-boot firewall..."
+  {{shquote .Binary}} --initialize-early-boot-firewall || true
+fi
@@ -0,0 +1,20 @@
+;; Mullvad VPN daemon
+(define mullvad-daemon
+  (service '(mullvad-daemon)
+    #:documentation "Mullvad VPN daemon"
+{{- if .Requires}}
+    #:requirement '({{join .Requires " "}})
+{{- end}}
+    #:start (make-forkexec-constructor
+             '({{range $i, $a := .Argv}}{{if $i}} {{end}}{{quote $a}}{{end}})
+{{- if .Env}}
+             #:environment-variables
+             (append '({{range $i, $e := .EnvPairs}}{{if $i}} {{end}}{{quote $e}}{{end}})
+                     (default-environment-variables))
+{{- end}}
+             #:log-file {{quote .LogFile}})
+    #:stop (make-kill-destructor)
+    #:respawn? #t
+    #:respawn-delay {{.RestartSeconds}}))
+
+(register-services (list mullvad-daemon))
@@ -1,13 +1,13 @@
 package ui
 
 const (
-	MsgWelcome         = "=== Welcome to Mullvad VPN Installer ==="
-	MsgSelectChannel   = "Select release channel:"
-	MsgConfirmAction   = "Proceed to %s with channel %q?"
-	MsgRemoveOld       = "Remove old installation first?"
-	MsgSelectXZBackend = "Select XZ backend:"
-	MsgInvalidYesNo    = "Please answer yes or no."
-	MsgInvalidChoice   = "Please select a valid option."
-	OptStable          = "stable"
-	OptBeta            = "beta"
+	MsgWelcome       = "=== Welcome to Mullvad VPN Installer ==="
+	MsgSelectChannel = "Select release channel:"
+	MsgConfirmAction = "Proceed to %s with channel %q?"
+	MsgRemoveOld     = "Remove old installation first?"
+	MsgConfirmRemove = "Remove Mullvad VPN, including its configuration under /etc?"
+	MsgInvalidYesNo  = "Please answer yes or no."
+	MsgInvalidChoice = "Please select a valid option."
+	OptStable        = "stable"
+	OptBeta          = "beta"
 )
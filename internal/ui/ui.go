@@ -200,11 +200,6 @@ func SelectTwo(
 	}
 }
 
-const (
-	OptGoXZ     = "Built-in parsers (Go AR + Go XZ decompressor; portable, slower)"
-	OptSystemXZ = "System utilities (ar+xz; high-performance, requires binutils and xz installed)"
-)
-
 func SelectStableBeta(msg string, onResult func(string)) Step {
 	return SelectTwo(msg, OptStable, OptBeta, true, func(first bool) {
 		if first {
@@ -214,9 +209,3 @@ func SelectStableBeta(msg string, onResult func(string)) Step {
 		}
 	})
 }
-
-func SelectXZBackend(msg string, onResult func(useSystem bool)) Step {
-	return SelectTwo(msg, OptGoXZ, OptSystemXZ, true, func(first bool) {
-		onResult(!first)
-	})
-}
@@ -17,7 +17,6 @@ type UserContext struct {
 	Channel          string
 	Confirmed        bool
 	DoRemove         bool
-	UseSystemXZ      bool
 }
 
 type Wizard struct {
@@ -104,9 +103,6 @@ func (w *Wizard) Run(u *ui.UI) (*UserContext, error) {
 				},
 			),
 		}.Run,
-		ui.SelectXZBackend(ui.MsgSelectXZBackend, func(sys bool) {
-			ctx.UseSystemXZ = sys
-		}),
 	}
 	if err := u.RunAll(followup...); err != nil {
 		return nil, err
@@ -2,18 +2,24 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"flag"
 	"fmt"
 	"os"
 	"os/signal"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/you/mullvad-installer/internal/arch"
 	"github.com/you/mullvad-installer/internal/config"
+	"github.com/you/mullvad-installer/internal/debpkg"
 	"github.com/you/mullvad-installer/internal/github"
 	initpkg "github.com/you/mullvad-installer/internal/init"
 	"github.com/you/mullvad-installer/internal/installer"
 	"github.com/you/mullvad-installer/internal/remove"
+	"github.com/you/mullvad-installer/internal/service"
 	"github.com/you/mullvad-installer/internal/ui"
 	"github.com/you/mullvad-installer/internal/wizard"
 )
@@ -33,9 +39,24 @@ func main() {
 }
 
 func run() error {
-	cfg := config.ParseFlags()
+	cfg, err := config.ParseFlags()
+	if errors.Is(err, flag.ErrHelp) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
 	ui.InitLogger(cfg.NoColor)
 
+	switch cfg.Action {
+	case config.ActionInspect:
+		return runInspect(cfg)
+	case config.ActionStatus:
+		return runStatus(cfg)
+	case config.ActionRenderService:
+		return runRenderService(cfg)
+	}
+
 	if os.Geteuid() != 0 {
 		ui.Info("--help")
 		return errors.New("Need to be root")
@@ -45,6 +66,9 @@ func run() error {
 	defer cancel()
 
 	u := ui.NewUI(os.Stdin, os.Stdout, os.Stderr, cfg.AssumeYes, cfg.DryRun, cfg.NoColor)
+	if cfg.Action == config.ActionRemove {
+		return runUninstall(cfg, u)
+	}
 
 	userCtx, err := wizard.NewConfirmationWizard(cfg).Run(u)
 	if err != nil {
@@ -55,35 +79,81 @@ func run() error {
 		return nil
 	}
 
+	initSys, err := chooseInit(cfg)
+	if err != nil {
+		return err
+	}
+
+	// Whatever is installed now is set aside before anything changes, so
+	// any failure up to a healthy daemon puts it back.
+	var backup *installer.Backup
+	if !cfg.DryRun {
+		if backup, err = installer.BackupPrevious(cfg, initSys); err != nil {
+			return fmt.Errorf("back up previous installation: %w", err)
+		}
+	}
 	if userCtx.DoRemove {
 		ui.Info("Removing previous installation…")
-		if err := remove.Remove(cfg); err != nil {
-			return fmt.Errorf("remove: %w", err)
+		err := installer.Guard(func() error { return remove.Remove(cfg, initSys, remove.Upgrade) })
+		if err != nil {
+			return rollback(backup, fmt.Errorf("remove: %w", err))
 		}
 		ui.Info("Old installation removed")
 	}
 
 	osInfo := arch.Detect()
-	initSys := initpkg.Detect()
 
 	rel, err := fetchRelease(ctx, u, userCtx.Channel)
 	if err != nil {
-		return fmt.Errorf("fetch release: %w", err)
+		return rollback(backup, fmt.Errorf("fetch release: %w", err))
 	}
 	ui.Info("Selected release:", rel.Tag)
 
 	ui.Info("Installing…")
-	if err := installer.Install(rel, osInfo, cfg, u, userCtx.UseSystemXZ); err != nil {
-		return fmt.Errorf("install: %w", err)
+	if err := installer.Install(rel, osInfo, cfg, u); err != nil {
+		return rollback(backup, fmt.Errorf("install: %w", err))
 	}
 	if err := installer.SetupService(initSys, cfg); err != nil {
-		ui.Warn("service setup warning:", err)
+		return rollback(backup, err)
+	}
+	if backup != nil {
+		backup.Discard()
 	}
 	ui.Info("Installation complete")
 
 	return nil
 }
 
+// runUninstall removes Mullvad VPN entirely, conffiles under /etc
+// included.
+func runUninstall(cfg *config.Config, u *ui.UI) error {
+	confirmed := false
+	if err := u.RunAll(ui.Confirm(ui.MsgConfirmRemove, false, func(ok bool) { confirmed = ok })); err != nil {
+		return err
+	}
+	if !confirmed {
+		ui.Info("Aborted by user")
+		return nil
+	}
+	initSys, err := chooseInit(cfg)
+	if err != nil {
+		return err
+	}
+	return remove.Remove(cfg, initSys, remove.Uninstall)
+}
+
+// rollback puts the previous installation back after an install failed
+// with cause, if one was set aside, and returns cause either way.
+func rollback(backup *installer.Backup, cause error) error {
+	if backup == nil {
+		return cause
+	}
+	if err := backup.Restore(); err != nil {
+		return fmt.Errorf("%w; restoring the previous installation also failed: %v", cause, err)
+	}
+	return fmt.Errorf("%w; the previous installation was restored", cause)
+}
+
 func fetchRelease(ctx context.Context, u *ui.UI, channel string) (*github.Release, error) {
 	if err := u.RunAll(ui.Spinner("Fetching releases", spinnerDots, spinnerRefresh)); err != nil {
 		return nil, err
@@ -106,3 +176,133 @@ func fetchRelease(ctx context.Context, u *ui.UI, channel string) (*github.Releas
 	}
 	return nil, fmt.Errorf("all retries failed: %w", lastErr)
 }
+
+// chooseInit returns the init system named by --init, or the detected one.
+// A wrong guess means service files for the wrong init system, so a weak
+// detection is called out.
+func chooseInit(cfg *config.Config) (initpkg.InitSystem, error) {
+	if cfg.Init != "" && cfg.Init != "auto" {
+		sys := initpkg.InitSystem(cfg.Init)
+		if !service.Supported(sys) {
+			return "", fmt.Errorf("--init: %w: %s", service.ErrUnsupported, sys)
+		}
+		ui.Info(fmt.Sprintf("Init system: %s (from --init)", sys))
+		return sys, nil
+	}
+
+	d := initpkg.Detect()
+	if cfg.Verbose {
+		for _, c := range d.Candidates {
+			ui.Info(fmt.Sprintf("  %s: score %d", c.System, c.Score))
+			for _, e := range c.Evidence {
+				ui.Info("    " + e)
+			}
+		}
+		for _, n := range d.Notes {
+			ui.Info("  note: " + n)
+		}
+	}
+	sys := d.Best()
+	conf := d.Confidence()
+	ui.Info(fmt.Sprintf("Detected init system: %s (%s confidence)", sys, conf))
+	if conf == "low" {
+		for _, n := range d.Notes {
+			if cfg.Verbose {
+				break
+			}
+			ui.Warn(n)
+		}
+		ui.Warn("init system detection is uncertain; pass --init to choose one (--verbose shows why)")
+	}
+	return sys, nil
+}
+
+func runStatus(cfg *config.Config) error {
+	initSys, err := chooseInit(cfg)
+	if err != nil {
+		return err
+	}
+	b, err := service.Lookup(initSys, service.ParamsFromConfig(cfg))
+	if err != nil {
+		return err
+	}
+	running, err := b.Status()
+	if err != nil {
+		return fmt.Errorf("status: %w", err)
+	}
+	state := "not running"
+	if running {
+		state = "running"
+	}
+	fmt.Printf("%s (%s): %s\n", service.DaemonName, initSys, state)
+	return nil
+}
+
+// runRenderService prints the service files the chosen backend would
+// install, after admin template overrides and config parameters apply.
+func runRenderService(cfg *config.Config) error {
+	initSys, err := chooseInit(cfg)
+	if err != nil {
+		return err
+	}
+	b, err := service.Lookup(initSys, service.ParamsFromConfig(cfg))
+	if err != nil {
+		return err
+	}
+	files, err := b.Render()
+	if err != nil {
+		return fmt.Errorf("render %s service: %w", initSys, err)
+	}
+	for i, f := range files {
+		if i > 0 {
+			fmt.Println()
+		}
+		src := f.Source
+		if src == "" {
+			src = "copied from the package"
+		}
+		fmt.Printf("==> %s (%#o, %s) <==\n", f.Path, f.Mode, src)
+		os.Stdout.Write(f.Data)
+	}
+	return nil
+}
+
+func runInspect(cfg *config.Config) error {
+	if len(cfg.Args) != 1 {
+		return errors.New("usage: inspect [--json] <file.deb>")
+	}
+	info, err := debpkg.Inspect(cfg.Args[0])
+	if err != nil {
+		return fmt.Errorf("inspect: %w", err)
+	}
+
+	if cfg.JSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(info)
+	}
+
+	c := info.Control
+	fmt.Printf("Package:        %s\n", c.Package)
+	fmt.Printf("Version:        %s\n", c.Version)
+	fmt.Printf("Architecture:   %s\n", c.Architecture)
+	fmt.Printf("Installed-Size: %d KiB\n", c.InstalledSize)
+	fmt.Printf("Depends:        %s\n", strings.Join(c.Depends, ", "))
+	fmt.Printf("Files:          %d (md5sums)\n", len(info.MD5Sums))
+
+	fmt.Println("Conffiles:")
+	for _, cf := range info.Conffiles {
+		fmt.Println("  " + cf)
+	}
+
+	scripts := make([]string, 0, len(info.Scripts))
+	for name := range info.Scripts {
+		scripts = append(scripts, name)
+	}
+	sort.Strings(scripts)
+	fmt.Println("Maintainer scripts:")
+	for _, name := range scripts {
+		fmt.Printf("  %s (%d bytes)\n", name, len(info.Scripts[name]))
+	}
+	return nil
+}